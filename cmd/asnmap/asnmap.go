@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"os"
 	"os/signal"
+	"syscall"
 
 	asnmap "github.com/projectdiscovery/asnmap/libs"
 	"github.com/projectdiscovery/asnmap/runner"
@@ -20,32 +22,52 @@ func main() {
 		gologger.Fatal().Msgf("Could not create runner: %s\n", err)
 	}
 
-	defer func() {
-		_ = asnmapRunner.Close()
-	}()
-
-	// Setup graceful exits
+	// Setup graceful exits: the first signal stops new lookups and lets the in-flight ones
+	// complete, a second one exits immediately. Signals are handled here while the runner
+	// works in the background, so that it is only closed from this goroutine.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	done := make(chan error, 1)
 	go func() {
-		for range c {
-			gologger.Info().Msgf("CTRL+C pressed: Exiting\n")
-			// Close should be called explicitly as it doesn't honor
-			_ = asnmapRunner.Close()
-			os.Exit(1)
-		}
-	}()
-
-	if err := asnmapRunner.Run(); err != nil {
+		err := asnmapRunner.RunWithContext(ctx)
 		if errors.Is(err, asnmap.ErrUnAuthorized) {
 			gologger.Info().Msgf("Try again after authenticating with PDCP\n\n")
 			// trigger auth callback
 			pdcp.CheckNValidateCredentials("asnmap")
-			// run again
-			if err := asnmapRunner.Run(); err != nil {
-				gologger.Fatal().Msgf("%s\n", err)
+			// run again, the output files of the first run are reused
+			err = asnmapRunner.RunWithContext(ctx)
+		}
+		done <- err
+	}()
+
+	interrupted := false
+wait:
+	for {
+		select {
+		case err = <-done:
+			break wait
+		case <-c:
+			if !interrupted {
+				interrupted = true
+				gologger.Info().Msgf("Signal received: finishing in-flight lookups, press CTRL+C again to exit immediately\n")
+				cancel()
+				continue
 			}
+			gologger.Info().Msgf("Exiting\n")
+			// Close waits for the results being written and saves the progress
+			_ = asnmapRunner.Close()
+			os.Exit(runner.ExitCodeInterrupted)
 		}
+	}
+	signal.Stop(c)
+	_ = asnmapRunner.Close()
+
+	if errors.Is(err, runner.ErrInterrupted) {
+		os.Exit(runner.ExitCodeInterrupted)
+	}
+	if err != nil {
 		gologger.Fatal().Msgf("%s\n", err)
 	}
 }
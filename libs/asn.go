@@ -0,0 +1,125 @@
+package asnmap
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	stringsutil "github.com/projectdiscovery/utils/strings"
+)
+
+// maxASNRangeSize bounds how many lookups a single asn range can expand to
+const maxASNRangeSize = 4096
+
+// reservedASNs lists the IANA special-purpose asn blocks that are never publicly routed
+var reservedASNs = []struct {
+	first, last uint32
+	reason      string
+}{
+	{0, 0, "reserved ASN (RFC 7607)"},
+	{23456, 23456, "AS_TRANS (RFC 6793)"},
+	{64496, 64511, "documentation ASN (RFC 5398)"},
+	{64512, 65534, "private use ASN (RFC 6996)"},
+	{65535, 65535, "reserved ASN (RFC 7300)"},
+	{65536, 65551, "documentation ASN (RFC 5398)"},
+	{65552, 131071, "reserved ASN"},
+	{4200000000, 4294967294, "private use ASN (RFC 6996)"},
+	{4294967295, 4294967295, "reserved ASN (RFC 7300)"},
+}
+
+// ParseASN parses an asn in asplain (AS65546, 65546) or asdot (AS1.10) notation
+func ParseASN(input string) (uint32, error) {
+	value := input
+	if stringsutil.HasPrefixI(value, "AS") {
+		value = value[2:]
+	}
+
+	high, low, isASDot := strings.Cut(value, ".")
+	if !isASDot {
+		asn, err := strconv.ParseUint(value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid asn '%s': must be a number between 0 and 4294967295", input)
+		}
+		return uint32(asn), nil
+	}
+
+	highValue, errHigh := strconv.ParseUint(high, 10, 16)
+	lowValue, errLow := strconv.ParseUint(low, 10, 16)
+	if errHigh != nil || errLow != nil {
+		return 0, fmt.Errorf("invalid asdot asn '%s': both parts must be between 0 and 65535", input)
+	}
+	return uint32(highValue<<16 | lowValue), nil
+}
+
+// ParseASNRange parses an asn range such as AS64500-AS64510 or AS64500-64510
+func ParseASNRange(input string) (uint32, uint32, error) {
+	start, end, ok := strings.Cut(input, "-")
+	if !ok || !stringsutil.HasPrefixI(start, "AS") {
+		return 0, 0, fmt.Errorf("invalid asn range: %s", input)
+	}
+	first, err := ParseASN(strings.TrimSpace(start))
+	if err != nil {
+		return 0, 0, err
+	}
+	last, err := ParseASN(strings.TrimSpace(end))
+	if err != nil {
+		return 0, 0, err
+	}
+	if last < first {
+		return 0, 0, errors.New("asn range end is lower than its start")
+	}
+	if uint64(last)-uint64(first) >= maxASNRangeSize {
+		return 0, 0, fmt.Errorf("asn range '%s' is too large, at most %d asns are allowed", input, maxASNRangeSize)
+	}
+	return first, last, nil
+}
+
+// ReservedASN returns why the asn is not publicly routable, or an empty string for public asns
+func ReservedASN(asn uint32) string {
+	for _, reserved := range reservedASNs {
+		if asn >= reserved.first && asn <= reserved.last {
+			return reserved.reason
+		}
+	}
+	return ""
+}
+
+func checkIfASNRange(input string) bool {
+	if !strings.Contains(input, "-") {
+		return false
+	}
+	_, _, err := ParseASNRange(input)
+	return err == nil
+}
+
+// checkIfASDot checks if the input is a number in asdot notation (1.10)
+func checkIfASDot(input string) bool {
+	high, low, ok := strings.Cut(input, ".")
+	return ok && checkIfASNId(high) && checkIfASNId(low)
+}
+
+// getDataForASNRange looks up every asn of the range, the responses are tagged with the range.
+// Asns the api has no data for are skipped.
+func (c Client) getDataForASNRange(input string) ([]*Response, error) {
+	first, last, err := ParseASNRange(input)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Response
+	for asn := uint64(first); asn <= uint64(last); asn++ {
+		responses, err := c.GetData(strconv.FormatUint(asn, 10))
+		if errors.Is(err, ErrBadRequest) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, response := range responses {
+			response.Input = input
+			response.InputType = ASNRange.String()
+		}
+		results = append(results, responses...)
+	}
+	return results, nil
+}
@@ -0,0 +1,124 @@
+package asnmap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseASN(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected uint32
+		err      bool
+	}{
+		{"AS14421", 14421, false},
+		{"as14421", 14421, false},
+		{"14421", 14421, false},
+		{"AS1.10", 65546, false},
+		{"AS65535.65535", 4294967295, false},
+		{"AS4294967295", 4294967295, false},
+		{"AS4294967296", 0, true},
+		{"AS65536.1", 0, true},
+		{"AS1.", 0, true},
+		{"ASX", 0, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			asn, err := ParseASN(tc.input)
+			if tc.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tc.expected, asn)
+		})
+	}
+}
+
+func TestParseASNRange(t *testing.T) {
+	first, last, err := ParseASNRange("AS64500-AS64510")
+	require.Nil(t, err)
+	require.Equal(t, uint32(64500), first)
+	require.Equal(t, uint32(64510), last)
+
+	first, last, err = ParseASNRange("AS1.10-AS1.12")
+	require.Nil(t, err)
+	require.Equal(t, uint32(65546), first)
+	require.Equal(t, uint32(65548), last)
+
+	_, _, err = ParseASNRange("AS64510-AS64500")
+	require.NotNil(t, err)
+	_, _, err = ParseASNRange("AS1-AS4294967295")
+	require.NotNil(t, err)
+	_, _, err = ParseASNRange("64500-64510")
+	require.NotNil(t, err)
+}
+
+func TestReservedASN(t *testing.T) {
+	require.Equal(t, "", ReservedASN(14421))
+	require.Equal(t, "", ReservedASN(4200000000-1))
+	require.Contains(t, ReservedASN(64512), "RFC 6996")
+	require.Contains(t, ReservedASN(4200000000), "RFC 6996")
+	require.Contains(t, ReservedASN(65535), "RFC 7300")
+	require.Contains(t, ReservedASN(4294967295), "RFC 7300")
+}
+
+func TestGetDataForASN(t *testing.T) {
+	var queried []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		asn := req.URL.Query().Get("asn")
+		queried = append(queried, asn)
+		if asn == "14422" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("no data"))
+			return
+		}
+		_, _ = w.Write([]byte(`[{"first_ip":"216.101.17.0","last_ip":"216.101.17.255","asn":` + asn + `,"country":"US","org":"test"}]`))
+	}))
+	defer server.Close()
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	client, err := NewClient()
+	require.Nil(t, err)
+
+	results, err := client.GetData("AS3.10")
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "196618", results[0].Input)
+	require.Equal(t, []string{"196618"}, queried)
+
+	queried = nil
+	results, err = client.GetData("AS14421-AS14423")
+	require.Nil(t, err)
+	require.Equal(t, []string{"14421", "14422", "14423"}, queried)
+	// asns without data are skipped, the responses are tagged with the range
+	require.Len(t, results, 2)
+	for i, asn := range []int{14421, 14423} {
+		require.Equal(t, asn, results[i].ASN)
+		require.Equal(t, "AS14421-AS14423", results[i].Input)
+		require.Equal(t, "asn_range", results[i].InputType)
+	}
+
+	// reserved asns are annotated without querying the api
+	queried = nil
+	results, err = client.GetData("AS64512")
+	require.Nil(t, err)
+	require.Nil(t, queried)
+	require.Equal(t, []*Response{{Input: "64512", InputType: "asn", ASN: 64512, Annotation: "private use ASN (RFC 6996)"}}, results)
+
+	mapped, err := MapToResults(results)
+	require.Nil(t, err)
+	require.Equal(t, "AS64512", mapped[0].Input)
+	require.Empty(t, mapped[0].ASN)
+	require.Empty(t, mapped[0].AS_range)
+	require.Equal(t, "private use ASN (RFC 6996)", mapped[0].Annotation)
+
+	_, err = client.GetData("AS4294967296")
+	require.NotNil(t, err)
+}
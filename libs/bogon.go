@@ -0,0 +1,58 @@
+package asnmap
+
+import "net/netip"
+
+// specialPurposeBlocks lists the IANA special-purpose address blocks that are never
+// publicly routed, more specific blocks come first
+var specialPurposeBlocks = []struct {
+	prefix netip.Prefix
+	reason string
+}{
+	{netip.MustParsePrefix("0.0.0.0/8"), "this network (RFC 791)"},
+	{netip.MustParsePrefix("10.0.0.0/8"), "private use (RFC 1918)"},
+	{netip.MustParsePrefix("100.64.0.0/10"), "shared address space / CGNAT (RFC 6598)"},
+	{netip.MustParsePrefix("127.0.0.0/8"), "loopback (RFC 1122)"},
+	{netip.MustParsePrefix("169.254.0.0/16"), "link local (RFC 3927)"},
+	{netip.MustParsePrefix("172.16.0.0/12"), "private use (RFC 1918)"},
+	{netip.MustParsePrefix("192.0.0.0/24"), "IETF protocol assignments (RFC 6890)"},
+	{netip.MustParsePrefix("192.0.2.0/24"), "documentation (RFC 5737)"},
+	{netip.MustParsePrefix("192.88.99.0/24"), "deprecated 6to4 relay anycast (RFC 7526)"},
+	{netip.MustParsePrefix("192.168.0.0/16"), "private use (RFC 1918)"},
+	{netip.MustParsePrefix("198.18.0.0/15"), "benchmarking (RFC 2544)"},
+	{netip.MustParsePrefix("198.51.100.0/24"), "documentation (RFC 5737)"},
+	{netip.MustParsePrefix("203.0.113.0/24"), "documentation (RFC 5737)"},
+	{netip.MustParsePrefix("224.0.0.0/4"), "multicast (RFC 5771)"},
+	{netip.MustParsePrefix("255.255.255.255/32"), "limited broadcast (RFC 919)"},
+	{netip.MustParsePrefix("240.0.0.0/4"), "reserved (RFC 1112)"},
+	{netip.MustParsePrefix("::/128"), "unspecified (RFC 4291)"},
+	{netip.MustParsePrefix("::1/128"), "loopback (RFC 4291)"},
+	{netip.MustParsePrefix("64:ff9b:1::/48"), "local use IPv4/IPv6 translation (RFC 8215)"},
+	{netip.MustParsePrefix("100::/64"), "discard only (RFC 6666)"},
+	{netip.MustParsePrefix("2001:db8::/32"), "documentation (RFC 3849)"},
+	{netip.MustParsePrefix("3fff::/20"), "documentation (RFC 9637)"},
+	{netip.MustParsePrefix("fc00::/7"), "unique local (RFC 4193)"},
+	{netip.MustParsePrefix("fe80::/10"), "link local (RFC 4291)"},
+	{netip.MustParsePrefix("ff00::/8"), "multicast (RFC 4291)"},
+}
+
+// SpecialPurposeIP returns why the ip is not publicly routable (e.g. private use, loopback,
+// documentation), or an empty string for public and invalid ips
+func SpecialPurposeIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	_, reason := specialPurposeBlock(addr)
+	return reason
+}
+
+// specialPurposeBlock returns the special-purpose block containing the address
+func specialPurposeBlock(addr netip.Addr) (netip.Prefix, string) {
+	addr = addr.Unmap().WithZone("")
+	for _, block := range specialPurposeBlocks {
+		if block.prefix.Contains(addr) {
+			return block.prefix, block.reason
+		}
+	}
+	return netip.Prefix{}, ""
+}
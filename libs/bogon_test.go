@@ -0,0 +1,72 @@
+package asnmap
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpecialPurposeIP(t *testing.T) {
+	tt := []struct {
+		ip     string
+		reason string
+	}{
+		{"8.8.8.8", ""},
+		{"2606:4700::6810:6334", ""},
+		{"not an ip", ""},
+		{"0.1.2.3", "this network (RFC 791)"},
+		{"10.1.2.3", "private use (RFC 1918)"},
+		{"172.31.255.255", "private use (RFC 1918)"},
+		{"172.32.0.1", ""},
+		{"192.168.1.1", "private use (RFC 1918)"},
+		{"100.64.0.1", "shared address space / CGNAT (RFC 6598)"},
+		{"100.128.0.1", ""},
+		{"127.0.0.1", "loopback (RFC 1122)"},
+		{"169.254.169.254", "link local (RFC 3927)"},
+		{"192.0.2.10", "documentation (RFC 5737)"},
+		{"198.51.100.10", "documentation (RFC 5737)"},
+		{"203.0.113.10", "documentation (RFC 5737)"},
+		{"198.18.0.1", "benchmarking (RFC 2544)"},
+		{"224.0.0.251", "multicast (RFC 5771)"},
+		{"255.100.100.100", "reserved (RFC 1112)"},
+		{"255.255.255.255", "limited broadcast (RFC 919)"},
+		{"::", "unspecified (RFC 4291)"},
+		{"::1", "loopback (RFC 4291)"},
+		{"::ffff:10.0.0.1", "private use (RFC 1918)"},
+		{"2001:db8::1", "documentation (RFC 3849)"},
+		{"fd00::1", "unique local (RFC 4193)"},
+		{"fe80::1%eth0", "link local (RFC 4291)"},
+		{"ff02::1", "multicast (RFC 4291)"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.ip, func(t *testing.T) {
+			require.Equal(t, tc.reason, SpecialPurposeIP(tc.ip))
+		})
+	}
+}
+
+func TestGetDataForSpecialPurposeIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		t.Errorf("unexpected api request for %s", req.URL.RawQuery)
+	}))
+	defer server.Close()
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	client, err := NewClient()
+	require.Nil(t, err)
+
+	results, err := client.GetData("192.168.1.1")
+	require.Nil(t, err)
+	require.Equal(t, []*Response{{Input: "192.168.1.1", InputType: "ip", Annotation: "private use (RFC 1918)"}}, results)
+
+	mapped, err := MapToResults(results)
+	require.Nil(t, err)
+	require.Empty(t, mapped[0].ASN)
+	require.Empty(t, mapped[0].AS_range)
+	require.Equal(t, "private use (RFC 1918)", mapped[0].Annotation)
+}
@@ -9,6 +9,10 @@ import (
 func GetCIDR(output []*Response) ([]*net.IPNet, error) {
 	var cidrs []*net.IPNet
 	for _, res := range output {
+		// annotated responses carry no range
+		if res.FirstIp == "" && res.LastIp == "" {
+			continue
+		}
 		cidr, err := mapcidr.GetCIDRFromIPRange(net.ParseIP(res.FirstIp), net.ParseIP(res.LastIp))
 		if err != nil {
 			return nil, err
@@ -7,11 +7,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net"
 	"net/http"
 	url "net/url"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/projectdiscovery/gologger"
@@ -21,7 +22,6 @@ import (
 	stringsutil "github.com/projectdiscovery/utils/strings"
 	updateutils "github.com/projectdiscovery/utils/update"
 	urlutil "github.com/projectdiscovery/utils/url"
-	"golang.org/x/net/proxy"
 )
 
 const serverURL = "https://asn.projectdiscovery.io/"
@@ -29,20 +29,36 @@ const serverURL = "https://asn.projectdiscovery.io/"
 var (
 	PDCPApiKey      = env.GetEnvOrDefault("PDCP_API_KEY", "")
 	ErrUnAuthorized = errors.New("unauthorized: 401 (get free api key to configure from https://cloud.projectdiscovery.io/?ref=api_key)")
+	// ErrBadRequest is returned when the api rejects the query, e.g. for an asn it has no data for
+	ErrBadRequest = errors.New("bad request")
 )
 
-func init() {
-	if PDCPApiKey == "" {
-		pch := pdcp.PDCPCredHandler{}
-		if creds, err := pch.GetCreds(); err == nil {
-			PDCPApiKey = creds.APIKey
+var loadCredsOnce sync.Once
+
+// getAPIKey returns the configured api key, falling back to the
+// PDCP credentials file on first use instead of reading it at import time
+func getAPIKey() string {
+	loadCredsOnce.Do(func() {
+		if PDCPApiKey == "" {
+			pch := pdcp.PDCPCredHandler{}
+			if creds, err := pch.GetCreds(); err == nil {
+				PDCPApiKey = creds.APIKey
+			}
 		}
-	}
+	})
+	return PDCPApiKey
 }
 
 type Client struct {
-	url  *url.URL
-	http *http.Client
+	url       *url.URL
+	http      *http.Client
+	tlsConfig *tls.Config
+
+	// transport is the base round tripper wrapped by the registered middlewares
+	transport     http.RoundTripper
+	middlewares   []Middleware
+	requestHooks  []RequestHook
+	responseHooks []ResponseHook
 }
 
 // generatefullURL creates the complete URL with path, scheme, and host
@@ -75,132 +91,146 @@ func NewClient() (*Client, error) {
 		return nil, err
 	}
 
-	// ignore expired SSL certificates
-	transCfg := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-
 	client := Client{
-		url:  URL,
-		http: &http.Client{Transport: transCfg},
+		url:       URL,
+		http:      &http.Client{},
+		tlsConfig: defaultTLSConfig(),
 	}
+	client.setTransport(&http.Transport{
+		TLSClientConfig: client.tlsConfig.Clone(),
+	})
 	return &client, nil
 }
 
-// SetProxy adds a proxy to the client
+// SetProxy adds a proxy to the client. All reachable proxies of the list are used in
+// rotation (see SetProxyPool), the first of them is returned.
 func (c *Client) SetProxy(proxyList []string) (*url.URL, error) {
-	var (
-		proxyUrl *url.URL
-		err      error
-	)
-	for _, p := range proxyList {
-		switch {
-		case fileutil.FileExists(p):
-			proxyUrl, err = c.setProxyFromFile(p)
-		default:
-			proxyUrl, err = c.setProxy(p)
-		}
-		if err == nil && proxyUrl != nil {
-			return proxyUrl, nil
-		}
-	}
-	return nil, errors.New("no valid proxy found")
-}
-
-// setProxyFromFile reads the file contents and tries to set the proxy
-func (c *Client) setProxyFromFile(fileName string) (*url.URL, error) {
-	file, err := os.Open(fileName)
+	pool, err := c.SetProxyPool(proxyList)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		proxy := strings.TrimSpace(scanner.Text())
-		if proxy == "" {
-			continue
-		}
-		proxyUrl, err := c.setProxy(proxy)
-		if err == nil && proxyUrl != nil {
-			return proxyUrl, nil
+	for _, pp := range pool.proxies {
+		if pp.healthy.Load() {
+			return pp.url, nil
 		}
 	}
-	return nil, fmt.Errorf("no valid proxy found in file '%s'", fileName)
+	return nil, ErrNoHealthyProxy
 }
 
-// setProxy sets a proxy to the client
-func (c *Client) setProxy(proxyString string) (*url.URL, error) {
-	// parse the proxy url string
-	proxyurl, err := url.Parse(proxyString)
+// SetProxyPool routes api requests through a pool of the given proxies (proxy urls or files
+// with one proxy per line). Requests rotate between the reachable proxies.
+func (c *Client) SetProxyPool(proxyList []string) (*ProxyPool, error) {
+	proxies, err := readProxyList(proxyList)
 	if err != nil {
 		return nil, err
 	}
-
-	// try to connect to the proxy
-	_, err = net.DialTimeout("tcp", fmt.Sprintf("%s:%s", proxyurl.Hostname(), proxyurl.Port()), time.Second*5)
+	pool, err := NewProxyPool(proxies, c.tlsConfig)
 	if err != nil {
 		return nil, err
 	}
+	if pool.Check() == 0 {
+		return nil, errors.New("no valid proxy found")
+	}
+	c.setTransport(pool)
+	return pool, nil
+}
 
-	switch proxyurl.Scheme {
-	case "http", "https":
-		c.http.Transport = &http.Transport{
-			Proxy:           http.ProxyURL(proxyurl),
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// readProxyList expands proxy files into the list of proxies they contain
+func readProxyList(proxyList []string) ([]string, error) {
+	var proxies []string
+	for _, p := range proxyList {
+		if !fileutil.FileExists(p) {
+			proxies = append(proxies, p)
+			continue
 		}
-		return proxyurl, nil
-	case "socks5":
-		dialer, err := proxy.SOCKS5("tcp", proxyurl.Host, nil, proxy.Direct)
+		file, err := os.Open(p)
 		if err != nil {
 			return nil, err
 		}
-		c.http.Transport = &http.Transport{
-			Dial: dialer.Dial,
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if proxy := strings.TrimSpace(scanner.Text()); proxy != "" {
+				proxies = append(proxies, proxy)
+			}
+		}
+		_ = file.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("could not read proxy file '%s': %w", p, err)
 		}
-		return proxyurl, nil
-	default:
-		return nil, fmt.Errorf("invalid proxy scheme: %s", proxyurl.Scheme)
 	}
+	return proxies, nil
 }
 
-func (c Client) makeRequest() ([]byte, error) {
+func (c Client) makeRequest(requestURL *url.URL) ([]byte, error) {
 	if c.http == nil {
 		return nil, errors.New("http client is not initialized")
 	}
 
-	req, err := http.NewRequest(http.MethodGet, c.url.String(), nil)
+	req, err := http.NewRequest(http.MethodGet, requestURL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
-	if PDCPApiKey == "" {
+	apiKey := getAPIKey()
+	if apiKey != "" {
+		req.Header.Set("X-PDCP-Key", apiKey)
+	}
+
+	for _, hook := range c.requestHooks {
+		hook(req)
+	}
+
+	var (
+		resBody    []byte
+		statusCode int
+		start      = time.Now()
+	)
+	// requests without api key aren't sent, the hooks still observe them as failed
+	if apiKey == "" {
 		gologger.Error().Label("asnmap-api").Msgf("missing or invalid api key (get free api key & configure it from https://cloud.projectdiscovery.io/?ref=api_key)")
-		return nil, ErrUnAuthorized
+		err = ErrUnAuthorized
+	} else {
+		resBody, statusCode, err = c.do(req)
 	}
-	req.Header.Set("X-PDCP-Key", PDCPApiKey)
+	if len(c.responseHooks) > 0 {
+		stats := RequestStats{
+			Request:    req,
+			StatusCode: statusCode,
+			Bytes:      int64(len(resBody)),
+			Duration:   time.Since(start),
+			Err:        err,
+		}
+		for _, hook := range c.responseHooks {
+			hook(stats)
+		}
+	}
+	return resBody, err
+}
+
+// do sends the request and returns the body along with the response status code
+func (c Client) do(req *http.Request) ([]byte, int, error) {
 	res, err := c.http.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode == http.StatusUnauthorized {
 		gologger.Error().Msgf("missing or invalid api key (get free api key & configure it from https://cloud.projectdiscovery.io/?ref=api_key)")
-		return nil, ErrUnAuthorized
+		return nil, res.StatusCode, ErrUnAuthorized
 	}
 
 	if res.StatusCode == http.StatusBadRequest {
 		body, _ := io.ReadAll(res.Body)
-		bodyStr := string(body)
-		errMsg := fmt.Sprintf("bad request: %s", bodyStr)
+		err := fmt.Errorf("%w: %s", ErrBadRequest, body)
 
-		gologger.Error().Msg(errMsg)
-		return nil, errors.New(errMsg)
+		gologger.Error().Msg(err.Error())
+		return body, res.StatusCode, err
 	}
 
 	resBody, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, res.StatusCode, err
 	}
-	return resBody, nil
+	return resBody, res.StatusCode, nil
 }
 
 func (c Client) GetDataWithCustomInput(inputToQuery, inputToUseInResponse string) ([]*Response, error) {
@@ -212,27 +242,49 @@ func (c Client) GetDataWithCustomInput(inputToQuery, inputToUseInResponse string
 }
 
 func (c Client) GetData(input string, medatadas ...string) ([]*Response, error) {
+	return c.GetDataAs(input, IdentifyInput(input))
+}
+
+// GetDataAs queries the input as the given type instead of identifying it, e.g. to
+// look up an org named like a domain
+func (c Client) GetDataAs(input string, inputType InputType) ([]*Response, error) {
 	inputToStore := input
 	params := urlutil.NewOrderedParams()
-	switch IdentifyInput(input) {
-	case ASN:
-		inputToStore = strings.TrimPrefix(strings.ToLower(input), "as")
+	switch inputType {
+	case ASN, ASNID:
+		asn, err := ParseASN(input)
+		if err != nil {
+			return nil, err
+		}
+		inputToStore = strconv.FormatUint(uint64(asn), 10)
+		// private and reserved asns are never announced, no need to query them
+		if reason := ReservedASN(asn); reason != "" {
+			return []*Response{{Input: inputToStore, InputType: inputType.String(), ASN: int(asn), Annotation: reason}}, nil
+		}
 		params.Add("asn", inputToStore)
-	case ASNID:
-		params.Add("asn", input)
+	case ASNRange:
+		return c.getDataForASNRange(input)
 	case IP:
+		// special-purpose addresses are never announced, no need to query them
+		if reason := SpecialPurposeIP(input); reason != "" {
+			return []*Response{{Input: inputToStore, InputType: inputType.String(), Annotation: reason}}, nil
+		}
 		params.Add("ip", input)
 	case Org:
-		params.Add("org", input)
+		params.Add("org", NormalizeOrg(input))
+	case CIDR, IPRange:
+		return c.getDataForRange(input, inputType)
 	case Unknown:
 		return nil, errors.New("unknown type")
 	}
 
 	params.Decode(updateutils.GetpdtmParams(Version))
 
-	c.url.RawQuery = params.Encode()
+	// the url is copied so that concurrent lookups don't share the query
+	requestURL := *c.url
+	requestURL.RawQuery = params.Encode()
 
-	resp, err := c.makeRequest()
+	resp, err := c.makeRequest(&requestURL)
 	if err != nil {
 		return nil, err
 	}
@@ -246,6 +298,7 @@ func (c Client) GetData(input string, medatadas ...string) ([]*Response, error)
 	// insert original input in all responses
 	for _, result := range results {
 		result.Input = inputToStore
+		result.InputType = inputType.String()
 	}
 
 	return results, nil
@@ -1,16 +1,60 @@
 package asnmap
 
+import (
+	"errors"
+	"sync"
+)
+
+// DefaultClient is the package level client used by GetData. It is created on first use.
+//
+// Deprecated: use GetDefaultClient and SetDefaultClient, which are safe for concurrent use.
 var DefaultClient *Client
 
-func init() {
-	var err error
-	DefaultClient, err = NewClient()
-	if err != nil {
-		// if we can't create the default client it makes sense to panic, as any other attempt will fail
-		panic(err)
+var (
+	defaultClientErr  error
+	defaultClientOnce sync.Once
+	defaultClientMu   sync.RWMutex
+)
+
+// GetDefaultClient returns the package level client, creating it on first use.
+// Construction errors (e.g. a malformed SERVER_URL) are returned to the caller
+// instead of failing at import time.
+func GetDefaultClient() (*Client, error) {
+	defaultClientOnce.Do(func() {
+		defaultClientMu.Lock()
+		defer defaultClientMu.Unlock()
+		// a client assigned to DefaultClient before first use is kept
+		if DefaultClient == nil {
+			DefaultClient, defaultClientErr = NewClient()
+		}
+	})
+
+	defaultClientMu.RLock()
+	defer defaultClientMu.RUnlock()
+	if defaultClientErr != nil {
+		return nil, defaultClientErr
+	}
+	if DefaultClient == nil {
+		return nil, errors.New("default client is not set")
 	}
+	return DefaultClient, nil
+}
+
+// SetDefaultClient replaces the package level client used by GetData,
+// applications embedding asnmap can use it to provide a preconfigured client.
+func SetDefaultClient(client *Client) {
+	// consume the lazy initialization so it never overrides an explicit client
+	defaultClientOnce.Do(func() {})
+
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	DefaultClient, defaultClientErr = client, nil
 }
 
 func GetData(input string) ([]*Response, error) {
-	return DefaultClient.GetData(input)
+	client, err := GetDefaultClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.GetData(input)
 }
@@ -0,0 +1,64 @@
+package asnmap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// resetDefaultClient restores the lazy initialization state of the default client
+func resetDefaultClient(t *testing.T) {
+	reset := func() {
+		defaultClientMu.Lock()
+		defer defaultClientMu.Unlock()
+		DefaultClient, defaultClientErr = nil, nil
+		defaultClientOnce = sync.Once{}
+	}
+	reset()
+	t.Cleanup(reset)
+}
+
+func TestDefaultClient(t *testing.T) {
+	t.Run("malformed server url", func(t *testing.T) {
+		resetDefaultClient(t)
+		t.Setenv("SERVER_URL", "ftp://asn.example.com")
+
+		_, err := GetData("AS14421")
+		require.NotNil(t, err)
+	})
+
+	t.Run("explicit client", func(t *testing.T) {
+		resetDefaultClient(t)
+		t.Setenv("SERVER_URL", "ftp://asn.example.com")
+
+		client := &Client{}
+		SetDefaultClient(client)
+		got, err := GetDefaultClient()
+		require.Nil(t, err)
+		require.Same(t, client, got)
+	})
+
+	t.Run("deprecated variable", func(t *testing.T) {
+		resetDefaultClient(t)
+		got, err := GetDefaultClient()
+		require.Nil(t, err)
+		require.Same(t, DefaultClient, got)
+
+		// a client assigned before first use is kept
+		resetDefaultClient(t)
+		client := &Client{}
+		DefaultClient = client
+		got, err = GetDefaultClient()
+		require.Nil(t, err)
+		require.Same(t, client, got)
+	})
+
+	t.Run("unset client", func(t *testing.T) {
+		resetDefaultClient(t)
+		SetDefaultClient(nil)
+
+		_, err := GetDefaultClient()
+		require.NotNil(t, err)
+	})
+}
@@ -0,0 +1,177 @@
+package asnmap
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain bounds how many CNAMEs the stub follows for a single query
+const maxCNAMEChain = 8
+
+// DNSRecords holds the records served by a StubDNSServer, keyed by host name.
+// Names are matched case-insensitively and with or without the trailing dot.
+type DNSRecords struct {
+	A     map[string][]string
+	AAAA  map[string][]string
+	CNAME map[string]string
+	MX    map[string][]string
+}
+
+// StubDNSServer is a small in-process DNS server answering from a fixed set of records.
+// It can be passed to ResolveDomain (or the runner's resolvers option) through Addr
+// so that domain lookups don't need network access.
+type StubDNSServer struct {
+	server  *dns.Server
+	conn    net.PacketConn
+	records DNSRecords
+	mu      sync.RWMutex
+}
+
+// NewStubDNSServer starts a stub dns server on a random localhost udp port
+func NewStubDNSServer(records DNSRecords) (*StubDNSServer, error) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &StubDNSServer{conn: conn, records: normalizeRecords(records)}
+	started := make(chan struct{})
+	s.server = &dns.Server{
+		PacketConn:        conn,
+		Handler:           dns.HandlerFunc(s.serveDNS),
+		NotifyStartedFunc: func() { close(started) },
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.server.ActivateAndServe()
+	}()
+
+	select {
+	case <-started:
+		return s, nil
+	case err := <-errCh:
+		_ = conn.Close()
+		if err == nil {
+			err = errors.New("dns stub server stopped unexpectedly")
+		}
+		return nil, err
+	}
+}
+
+// Addr returns the host:port the server listens on
+func (s *StubDNSServer) Addr() string {
+	return s.conn.LocalAddr().String()
+}
+
+// SetRecords replaces the records served by the server
+func (s *StubDNSServer) SetRecords(records DNSRecords) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = normalizeRecords(records)
+}
+
+// Close stops the server
+func (s *StubDNSServer) Close() error {
+	return s.server.Shutdown()
+}
+
+func (s *StubDNSServer) serveDNS(w dns.ResponseWriter, req *dns.Msg) {
+	msg := &dns.Msg{}
+	msg.SetReply(req)
+	msg.Authoritative = true
+	msg.RecursionAvailable = true
+
+	if len(req.Question) > 0 {
+		s.mu.RLock()
+		msg.Answer, msg.Rcode = s.answer(req.Question[0])
+		s.mu.RUnlock()
+	}
+
+	_ = w.WriteMsg(msg)
+}
+
+// answer builds the answer section for the question, following CNAMEs the
+// same way a recursive resolver would.
+func (s *StubDNSServer) answer(q dns.Question) ([]dns.RR, int) {
+	var rrs []dns.RR
+	name := strings.ToLower(q.Name)
+	for i := 0; i <= maxCNAMEChain; i++ {
+		target, hasCNAME := s.records.CNAME[name]
+		if hasCNAME && q.Qtype != dns.TypeCNAME {
+			rrs = append(rrs, &dns.CNAME{Hdr: rrHeader(name, dns.TypeCNAME), Target: target})
+			name = target
+			continue
+		}
+
+		switch q.Qtype {
+		case dns.TypeA:
+			for _, ip := range s.records.A[name] {
+				rrs = append(rrs, &dns.A{Hdr: rrHeader(name, dns.TypeA), A: net.ParseIP(ip)})
+			}
+		case dns.TypeAAAA:
+			for _, ip := range s.records.AAAA[name] {
+				rrs = append(rrs, &dns.AAAA{Hdr: rrHeader(name, dns.TypeAAAA), AAAA: net.ParseIP(ip)})
+			}
+		case dns.TypeMX:
+			for i, host := range s.records.MX[name] {
+				rrs = append(rrs, &dns.MX{Hdr: rrHeader(name, dns.TypeMX), Preference: uint16(10 * (i + 1)), Mx: host})
+			}
+		case dns.TypeCNAME:
+			if hasCNAME {
+				rrs = append(rrs, &dns.CNAME{Hdr: rrHeader(name, dns.TypeCNAME), Target: target})
+			}
+		}
+
+		if len(rrs) == 0 && !s.records.has(name) {
+			return nil, dns.RcodeNameError
+		}
+		return rrs, dns.RcodeSuccess
+	}
+	return nil, dns.RcodeServerFailure
+}
+
+func (r DNSRecords) has(name string) bool {
+	_, hasA := r.A[name]
+	_, hasAAAA := r.AAAA[name]
+	_, hasCNAME := r.CNAME[name]
+	_, hasMX := r.MX[name]
+	return hasA || hasAAAA || hasCNAME || hasMX
+}
+
+func rrHeader(name string, rrtype uint16) dns.RR_Header {
+	return dns.RR_Header{Name: name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 60}
+}
+
+// normalizeRecords lowercases and fully qualifies all names so lookups can match the question directly
+func normalizeRecords(records DNSRecords) DNSRecords {
+	normalized := DNSRecords{
+		A:     make(map[string][]string, len(records.A)),
+		AAAA:  make(map[string][]string, len(records.AAAA)),
+		CNAME: make(map[string]string, len(records.CNAME)),
+		MX:    make(map[string][]string, len(records.MX)),
+	}
+	for name, ips := range records.A {
+		normalized.A[canonicalName(name)] = ips
+	}
+	for name, ips := range records.AAAA {
+		normalized.AAAA[canonicalName(name)] = ips
+	}
+	for name, target := range records.CNAME {
+		normalized.CNAME[canonicalName(name)] = canonicalName(target)
+	}
+	for name, hosts := range records.MX {
+		for _, host := range hosts {
+			normalized.MX[canonicalName(name)] = append(normalized.MX[canonicalName(name)], canonicalName(host))
+		}
+	}
+	return normalized
+}
+
+func canonicalName(name string) string {
+	return dns.Fqdn(strings.ToLower(name))
+}
@@ -0,0 +1,158 @@
+package asnmap
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+const (
+	// sizes of the aligned blocks skipped after a lookup that found no owner. Prefixes
+	// longer than a /24 or a /48 aren't routed globally, so an address without owner
+	// means the rest of its block is unallocated as well.
+	missBlockBitsIPv4 = 24
+	missBlockBitsIPv6 = 48
+
+	// maxRangeBlocks bounds the lookups of a single cidr or ip range, a walk looks up
+	// about one address per routable /24 (ipv4) or /48 (ipv6) block it spans
+	maxRangeBlocks = 4096
+)
+
+// ParseIPRange parses a CIDR (1.2.3.0/22) or an ip range (1.2.3.4-1.2.5.9)
+// and returns the first and last address it covers
+func ParseIPRange(input string) (netip.Addr, netip.Addr, error) {
+	if prefix, err := netip.ParsePrefix(input); err == nil {
+		prefix = prefix.Masked()
+		return prefix.Addr(), lastAddr(prefix), nil
+	}
+
+	start, end, ok := strings.Cut(input, "-")
+	if !ok {
+		return netip.Addr{}, netip.Addr{}, fmt.Errorf("invalid ip range: %s", input)
+	}
+	first, err := netip.ParseAddr(strings.TrimSpace(start))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+	last, err := netip.ParseAddr(strings.TrimSpace(end))
+	if err != nil {
+		return netip.Addr{}, netip.Addr{}, err
+	}
+	first, last = first.Unmap(), last.Unmap()
+	if first.Is4() != last.Is4() {
+		return netip.Addr{}, netip.Addr{}, errors.New("ip range bounds must be of the same family")
+	}
+	if last.Less(first) {
+		return netip.Addr{}, netip.Addr{}, errors.New("ip range end is lower than its start")
+	}
+	return first, last, nil
+}
+
+func checkIfCIDR(input string) bool {
+	_, err := netip.ParsePrefix(input)
+	return err == nil
+}
+
+func checkIfIPRange(input string) bool {
+	if !strings.Contains(input, "-") {
+		return false
+	}
+	_, _, err := ParseIPRange(input)
+	return err == nil
+}
+
+// getDataForRange walks the range by looking up representative addresses.
+// Every lookup returns the owning range of the queried address so the walk
+// continues right after it, skipping the sub-range already covered. Addresses
+// without owner skip to the next aligned /24 or /48 block only.
+func (c Client) getDataForRange(input string, inputType InputType) ([]*Response, error) {
+	first, last, err := ParseIPRange(input)
+	if err != nil {
+		return nil, err
+	}
+
+	if block, reason := specialPurposeBlock(first); reason != "" && !lastAddr(block).Less(last) {
+		return []*Response{{Input: input, InputType: inputType.String(), Annotation: reason}}, nil
+	}
+	if routableBlocks(first, last, maxRangeBlocks) > maxRangeBlocks {
+		return nil, fmt.Errorf("ip range '%s' is too large, at most %d routable /%d blocks are allowed", input, maxRangeBlocks, missBlock(first).Bits())
+	}
+
+	var (
+		results []*Response
+		seen    = make(map[string]struct{})
+	)
+	for cur := first; cur.IsValid() && !last.Less(cur); {
+		// special-purpose blocks are skipped without lookups
+		if block, reason := specialPurposeBlock(cur); reason != "" {
+			cur = lastAddr(block).Next()
+			continue
+		}
+
+		responses, err := c.GetData(cur.String())
+		if err != nil {
+			return nil, err
+		}
+
+		var next netip.Addr
+		for _, response := range responses {
+			key := fmt.Sprintf("%d|%s|%s", response.ASN, response.FirstIp, response.LastIp)
+			if _, ok := seen[key]; !ok {
+				seen[key] = struct{}{}
+				response.Input = input
+				response.InputType = inputType.String()
+				results = append(results, response)
+			}
+			if !response.Contains(cur.String()) {
+				continue
+			}
+			if end, err := netip.ParseAddr(response.LastIp); err == nil && next.Less(end.Unmap()) {
+				next = end.Unmap()
+			}
+		}
+
+		if next.IsValid() {
+			cur = next.Next()
+			continue
+		}
+		// nobody owns the address, continue with the next block
+		cur = lastAddr(missBlock(cur)).Next()
+	}
+	return results, nil
+}
+
+// routableBlocks counts the /24 or /48 blocks of the range outside of the special-purpose
+// blocks, counting stops past the limit
+func routableBlocks(first, last netip.Addr, limit int) int {
+	blocks := 0
+	for cur := first; cur.IsValid() && !last.Less(cur) && blocks <= limit; {
+		if block, reason := specialPurposeBlock(cur); reason != "" {
+			cur = lastAddr(block).Next()
+			continue
+		}
+		blocks++
+		cur = lastAddr(missBlock(cur)).Next()
+	}
+	return blocks
+}
+
+// missBlock returns the aligned block skipped when the address has no owner
+func missBlock(addr netip.Addr) netip.Prefix {
+	bits := missBlockBitsIPv6
+	if addr.Is4() {
+		bits = missBlockBitsIPv4
+	}
+	block, _ := addr.Prefix(bits)
+	return block
+}
+
+// lastAddr returns the last address of the prefix
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for i := prefix.Bits(); i < len(bytes)*8; i++ {
+		bytes[i/8] |= 1 << (7 - i%8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
@@ -0,0 +1,141 @@
+package asnmap
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIPRange(t *testing.T) {
+	tt := []struct {
+		input string
+		first string
+		last  string
+		err   bool
+	}{
+		{"1.2.3.0/22", "1.2.0.0", "1.2.3.255", false},
+		{"1.2.3.4-1.2.5.9", "1.2.3.4", "1.2.5.9", false},
+		{"2405:aa00::/32", "2405:aa00::", "2405:aa00:ffff:ffff:ffff:ffff:ffff:ffff", false},
+		{"1.2.5.9-1.2.3.4", "", "", true},
+		{"1.2.3.4-2405:aa00::", "", "", true},
+		{"1.2.3.4", "", "", true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			first, last, err := ParseIPRange(tc.input)
+			if tc.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.Equal(t, tc.first, first.String())
+			require.Equal(t, tc.last, last.String())
+		})
+	}
+}
+
+func TestGetDataForRange(t *testing.T) {
+	allocations := []*Response{
+		{FirstIp: "20.0.0.0", LastIp: "20.0.1.255", ASN: 1, Org: "first"},
+		{FirstIp: "20.0.2.0", LastIp: "20.0.2.127", ASN: 2, Org: "second"},
+		// 20.0.2.128 - 20.0.3.255 is not allocated
+		{FirstIp: "20.0.4.0", LastIp: "20.0.4.255", ASN: 3, Org: "third"},
+		// 20.0.5.0 - 20.0.9.255 is not allocated
+		{FirstIp: "20.0.10.0", LastIp: "20.0.10.255", ASN: 4, Org: "fourth"},
+		{FirstIp: "20.0.12.0", LastIp: "20.0.15.255", ASN: 5, Org: "fifth"},
+	}
+	var queried []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := req.URL.Query().Get("ip")
+		queried = append(queried, ip)
+		responses := []*Response{}
+		for _, allocation := range allocations {
+			if allocation.Contains(ip) {
+				responses = append(responses, allocation)
+			}
+		}
+		_ = json.NewEncoder(w).Encode(responses)
+	}))
+	defer server.Close()
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	client, err := NewClient()
+	require.Nil(t, err)
+
+	results, err := client.GetData("20.0.0.0/20")
+	require.Nil(t, err)
+	var asns []int
+	for _, result := range results {
+		require.Equal(t, "20.0.0.0/20", result.Input)
+		asns = append(asns, result.ASN)
+	}
+	require.Equal(t, []int{1, 2, 3, 4, 5}, asns)
+
+	// every address is either covered by a returned range, or follows a lookup
+	// without owner in the same /24 block
+	missed := make(map[netip.Prefix]netip.Addr)
+	for _, ip := range queried {
+		addr := netip.MustParseAddr(ip)
+		covered := false
+		for _, result := range results {
+			covered = covered || result.Contains(ip)
+		}
+		if !covered {
+			block, _ := addr.Prefix(24)
+			missed[block] = addr
+		}
+	}
+	for addr := netip.MustParseAddr("20.0.0.0"); addr != netip.MustParseAddr("20.0.16.0"); addr = addr.Next() {
+		covered := false
+		for _, result := range results {
+			covered = covered || result.Contains(addr.String())
+		}
+		block, _ := addr.Prefix(24)
+		miss, ok := missed[block]
+		require.True(t, covered || (ok && !addr.Less(miss)), "address %s was neither queried nor covered", addr)
+	}
+
+	queried = nil
+	results, err = client.GetData("20.0.1.10-20.0.2.5")
+	require.Nil(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, []string{"20.0.1.10", "20.0.2.0"}, queried)
+
+	// special-purpose blocks are skipped without lookups
+	queried = nil
+	results, err = client.GetData("10.0.0.0/16")
+	require.Nil(t, err)
+	require.Nil(t, queried)
+	require.Equal(t, []*Response{{Input: "10.0.0.0/16", InputType: "cidr", Annotation: "private use (RFC 1918)"}}, results)
+
+	queried = nil
+	_, err = client.GetData("9.255.255.255-11.0.0.0")
+	require.Nil(t, err)
+	require.Equal(t, []string{"9.255.255.255", "11.0.0.0"}, queried)
+
+	queried = nil
+	_, err = client.GetData("223.255.255.255-255.255.255.255")
+	require.Nil(t, err)
+	require.Equal(t, []string{"223.255.255.255"}, queried)
+
+	// ranges spanning too many routable blocks are rejected before any lookup
+	first, last, err := ParseIPRange("20.0.0.0/12")
+	require.Nil(t, err)
+	require.Equal(t, maxRangeBlocks, routableBlocks(first, last, maxRangeBlocks))
+	first, last, err = ParseIPRange("9.255.255.255-11.0.0.0")
+	require.Nil(t, err)
+	require.Equal(t, 2, routableBlocks(first, last, maxRangeBlocks))
+	for _, input := range []string{"0.0.0.0/0", "20.0.0.0/11", "20.0.0.0-20.16.0.0", "2a00::/16", "::/0"} {
+		queried = nil
+		_, err = client.GetData(input)
+		require.ErrorContains(t, err, "is too large", input)
+		require.Nil(t, queried, input)
+	}
+}
@@ -0,0 +1,151 @@
+package asnmap
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics collects counters about api lookups and related activity
+// and exposes them in the Prometheus text exposition format.
+type Metrics struct {
+	lookups        atomic.Int64
+	cacheHits      atomic.Int64
+	dnsResolutions atomic.Int64
+	errors         atomic.Int64
+	responseBytes  atomic.Int64
+
+	mu            sync.Mutex
+	statusCodes   map[int]int64
+	latencySum    time.Duration
+	latencyCount  int64
+	latencyBucket []int64
+}
+
+// latencyBuckets are the upper bounds (in seconds) of the api latency histogram
+var latencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		statusCodes:   make(map[int]int64),
+		latencyBucket: make([]int64, len(latencyBuckets)),
+	}
+}
+
+// Instrument registers the collector on the client so every api request is recorded
+func (m *Metrics) Instrument(c *Client) {
+	c.OnResponse(m.ObserveRequest)
+}
+
+// ObserveRequest records a completed api request
+func (m *Metrics) ObserveRequest(stats RequestStats) {
+	m.lookups.Add(1)
+	m.responseBytes.Add(stats.Bytes)
+	if stats.Err != nil {
+		m.errors.Add(1)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.statusCodes[stats.StatusCode]++
+	m.latencySum += stats.Duration
+	m.latencyCount++
+	seconds := stats.Duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			m.latencyBucket[i]++
+		}
+	}
+}
+
+// CacheHit records a lookup answered without an api request
+func (m *Metrics) CacheHit() {
+	m.cacheHits.Add(1)
+}
+
+// DNSResolution records a domain resolution
+func (m *Metrics) DNSResolution() {
+	m.dnsResolutions.Add(1)
+}
+
+// Error records an error that didn't come from an api request (e.g. a failed resolution)
+func (m *Metrics) Error() {
+	m.errors.Add(1)
+}
+
+// WritePrometheus writes all metrics in the Prometheus text format
+func (m *Metrics) WritePrometheus(w io.Writer) error {
+	ew := &errWriter{w: w}
+
+	writeCounter(ew, "asnmap_lookups_total", "Total number of api lookups.", m.lookups.Load())
+	writeCounter(ew, "asnmap_cache_hits_total", "Total number of lookups answered without an api request.", m.cacheHits.Load())
+	writeCounter(ew, "asnmap_dns_resolutions_total", "Total number of domain resolutions.", m.dnsResolutions.Load())
+	writeCounter(ew, "asnmap_errors_total", "Total number of errors.", m.errors.Load())
+	writeCounter(ew, "asnmap_api_response_bytes_total", "Total number of api response body bytes.", m.responseBytes.Load())
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ew.printf("# HELP asnmap_api_responses_total Total number of api responses by status code.\n")
+	ew.printf("# TYPE asnmap_api_responses_total counter\n")
+	codes := make([]int, 0, len(m.statusCodes))
+	for code := range m.statusCodes {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		ew.printf("asnmap_api_responses_total{code=%q} %d\n", statusCodeLabel(code), m.statusCodes[code])
+	}
+
+	ew.printf("# HELP asnmap_api_request_duration_seconds Api request latency.\n")
+	ew.printf("# TYPE asnmap_api_request_duration_seconds histogram\n")
+	for i, bound := range latencyBuckets {
+		ew.printf("asnmap_api_request_duration_seconds_bucket{le=%q} %d\n", strconv.FormatFloat(bound, 'f', -1, 64), m.latencyBucket[i])
+	}
+	ew.printf("asnmap_api_request_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.latencyCount)
+	ew.printf("asnmap_api_request_duration_seconds_sum %s\n", strconv.FormatFloat(m.latencySum.Seconds(), 'f', -1, 64))
+	ew.printf("asnmap_api_request_duration_seconds_count %d\n", m.latencyCount)
+
+	return ew.err
+}
+
+// Handler returns an http handler serving the metrics, suitable for a /metrics endpoint
+func (m *Metrics) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = m.WritePrometheus(w)
+	})
+}
+
+func writeCounter(ew *errWriter, name, help string, value int64) {
+	ew.printf("# HELP %s %s\n", name, help)
+	ew.printf("# TYPE %s counter\n", name)
+	ew.printf("%s %d\n", name, value)
+}
+
+// statusCodeLabel returns the label used for a status code, requests without a response are reported as "none"
+func statusCodeLabel(code int) string {
+	if code == 0 {
+		return "none"
+	}
+	return strconv.Itoa(code)
+}
+
+// errWriter keeps the first write error so the exposition can be written without checking every line
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,86 @@
+package asnmap
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientHooksAndMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Request-Source") != "test" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(`[{"first_ip":"216.101.17.0","last_ip":"216.101.17.255","asn":14421,"country":"US","org":"theravance"}]`))
+	}))
+	defer server.Close()
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	client, err := NewClient()
+	require.Nil(t, err)
+
+	var transported int
+	client.Use(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			transported++
+			return next.RoundTrip(req)
+		})
+	})
+	client.OnRequest(func(req *http.Request) {
+		req.Header.Set("X-Request-Source", "test")
+	})
+	var observed []RequestStats
+	client.OnResponse(func(stats RequestStats) {
+		observed = append(observed, stats)
+	})
+	metrics := NewMetrics()
+	metrics.Instrument(client)
+
+	// middlewares survive a transport change
+	client.setTransport(&http.Transport{})
+
+	results, err := client.GetData("AS14421")
+	require.Nil(t, err)
+	require.Len(t, results, 1)
+
+	require.Equal(t, 1, transported)
+	require.Len(t, observed, 1)
+	require.Equal(t, http.StatusOK, observed[0].StatusCode)
+	require.Nil(t, observed[0].Err)
+	require.Positive(t, observed[0].Bytes)
+
+	metrics.CacheHit()
+	metrics.DNSResolution()
+
+	var buf bytes.Buffer
+	require.Nil(t, metrics.WritePrometheus(&buf))
+	out := buf.String()
+	require.Contains(t, out, "# TYPE asnmap_lookups_total counter\nasnmap_lookups_total 1\n")
+	require.Contains(t, out, "asnmap_cache_hits_total 1\n")
+	require.Contains(t, out, "asnmap_dns_resolutions_total 1\n")
+	require.Contains(t, out, "asnmap_errors_total 0\n")
+	require.Contains(t, out, `asnmap_api_responses_total{code="200"} 1`)
+	require.Contains(t, out, `asnmap_api_request_duration_seconds_bucket{le="+Inf"} 1`)
+	require.Contains(t, out, "asnmap_api_request_duration_seconds_count 1\n")
+
+	// requests without api key aren't sent, but hooks and metrics still observe them
+	PDCPApiKey = ""
+	_, err = client.GetData("AS14421")
+	require.ErrorIs(t, err, ErrUnAuthorized)
+	require.Equal(t, 1, transported)
+	require.Len(t, observed, 2)
+	require.Zero(t, observed[1].StatusCode)
+	require.ErrorIs(t, observed[1].Err, ErrUnAuthorized)
+
+	buf.Reset()
+	require.Nil(t, metrics.WritePrometheus(&buf))
+	require.Contains(t, buf.String(), "asnmap_lookups_total 2\n")
+	require.Contains(t, buf.String(), "asnmap_errors_total 1\n")
+}
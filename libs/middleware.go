@@ -0,0 +1,57 @@
+package asnmap
+
+import (
+	"net/http"
+	"time"
+)
+
+// Middleware wraps the round tripper used by the client for api requests
+type Middleware func(http.RoundTripper) http.RoundTripper
+
+// RequestHook is called with every api request before it is sent, it can be used to inject headers
+type RequestHook func(req *http.Request)
+
+// ResponseHook is called once every api request completes
+type ResponseHook func(stats RequestStats)
+
+// RequestStats describes a completed api request
+type RequestStats struct {
+	Request    *http.Request
+	StatusCode int   // zero if no response was received
+	Bytes      int64 // response body size
+	Duration   time.Duration
+	Err        error
+}
+
+// RoundTripperFunc adapts a function to the http.RoundTripper interface
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Use appends middlewares to the transport chain, the first registered middleware is the outermost
+func (c *Client) Use(middlewares ...Middleware) {
+	c.middlewares = append(c.middlewares, middlewares...)
+	c.setTransport(c.transport)
+}
+
+// OnRequest registers a hook called before every api request
+func (c *Client) OnRequest(hook RequestHook) {
+	c.requestHooks = append(c.requestHooks, hook)
+}
+
+// OnResponse registers a hook called after every api request
+func (c *Client) OnResponse(hook ResponseHook) {
+	c.responseHooks = append(c.responseHooks, hook)
+}
+
+// setTransport sets the base transport and rebuilds the middleware chain on top of it
+func (c *Client) setTransport(transport http.RoundTripper) {
+	c.transport = transport
+	var rt http.RoundTripper = transport
+	for i := len(c.middlewares) - 1; i >= 0; i-- {
+		rt = c.middlewares[i](rt)
+	}
+	c.http.Transport = rt
+}
@@ -0,0 +1,55 @@
+package asnmap
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeDomain converts an internationalised domain name (münchen.de) to its
+// ascii (punycode) form (xn--mnchen-3ya.de). Ascii domains are only lowercased.
+func NormalizeDomain(domain string) (string, error) {
+	if isASCII(domain) {
+		return strings.ToLower(domain), nil
+	}
+	return idna.Lookup.ToASCII(domain)
+}
+
+// NormalizeOrg normalises an organization name for lookups: compatibility
+// characters are decomposed (NFKC), case is folded, diacritics are stripped
+// and whitespace is collapsed, so that "Société  Générale" becomes "societe generale"
+func NormalizeOrg(org string) string {
+	stripDiacritics := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFKC)
+	normalized, _, err := transform.String(stripDiacritics, org)
+	if err != nil {
+		normalized = norm.NFKC.String(org)
+	}
+	// casers keep state, a new one is used per call so that lookups can normalise concurrently
+	normalized = cases.Fold().String(normalized)
+	return strings.Join(strings.Fields(normalized), " ")
+}
+
+// checkIfDomain checks if the input is a domain name, internationalised names are
+// checked in their ascii form
+func checkIfDomain(input string) bool {
+	if isASCII(input) {
+		return domainRegex.MatchString(input)
+	}
+	ascii, err := NormalizeDomain(input)
+	return err == nil && domainRegex.MatchString(ascii)
+}
+
+func isASCII(input string) bool {
+	for i := 0; i < len(input); i++ {
+		if input[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
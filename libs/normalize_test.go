@@ -0,0 +1,72 @@
+package asnmap
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"münchen.de", "xn--mnchen-3ya.de"},
+		{"MÜNCHEN.de", "xn--mnchen-3ya.de"},
+		{"例え.jp", "xn--r8jz45g.jp"},
+		{"example。com", "example.com"},
+		{"Google.COM", "google.com"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			domain, err := NormalizeDomain(tc.input)
+			require.Nil(t, err)
+			require.Equal(t, tc.expected, domain)
+		})
+	}
+}
+
+func TestNormalizeOrg(t *testing.T) {
+	tt := []struct {
+		input    string
+		expected string
+	}{
+		{"Société  Générale", "societe generale"},
+		{"Deutsche Telekom", "deutsche telekom"},
+		{"ＧＯＯＧＬＥ", "google"},
+		{"Straße", "strasse"},
+		{"Telefónica, S.A.", "telefonica, s.a."},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			require.Equal(t, tc.expected, NormalizeOrg(tc.input))
+		})
+	}
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for _, tc := range tt {
+					require.Equal(t, tc.expected, NormalizeOrg(tc.input))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+func TestResolveIDNDomain(t *testing.T) {
+	server, err := NewStubDNSServer(DNSRecords{
+		A: map[string][]string{"xn--mnchen-3ya.de": {"192.0.2.1"}},
+	})
+	require.Nil(t, err)
+	defer server.Close()
+
+	ips, err := ResolveDomain("münchen.de", server.Addr())
+	require.Nil(t, err)
+	require.Equal(t, []string{"192.0.2.1"}, ips)
+}
@@ -0,0 +1,356 @@
+package asnmap
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sliceutil "github.com/projectdiscovery/utils/slice"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// proxyDialTimeout is the timeout used to check if a proxy is reachable
+const proxyDialTimeout = 5 * time.Second
+
+// ErrNoHealthyProxy is returned when every proxy of the pool is marked unhealthy
+var ErrNoHealthyProxy = errors.New("no healthy proxy available")
+
+// ProxyPool is a round tripper rotating requests across a set of proxies.
+// Proxies that can't be reached or refuse to connect are marked unhealthy and
+// skipped until a health check finds them reachable again.
+type ProxyPool struct {
+	proxies  []*poolProxy
+	next     atomic.Uint64
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type poolProxy struct {
+	url      *url.URL
+	healthy  atomic.Bool
+	requests atomic.Int64
+	failures atomic.Int64
+
+	mu        sync.RWMutex
+	transport *http.Transport
+	lastErr   error
+}
+
+// proxyError is a failure of the proxy itself, as opposed to a failure of the api behind it
+type proxyError struct {
+	err error
+}
+
+func (e *proxyError) Error() string {
+	return e.err.Error()
+}
+
+func (e *proxyError) Unwrap() error {
+	return e.err
+}
+
+// isProxyError reports whether the request failed while dialing or connecting through the proxy
+func isProxyError(err error) bool {
+	var pe *proxyError
+	if errors.As(err, &pe) {
+		return true
+	}
+	// the http transport reports dial and tls failures to the proxy as proxyconnect errors
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "proxyconnect"
+}
+
+// ProxyStats describes the usage of a single proxy of the pool
+type ProxyStats struct {
+	URL       string
+	Healthy   bool
+	Requests  int64
+	Failures  int64
+	LastError string
+}
+
+// NewProxyPool creates a pool from proxy urls (http, https, socks5 and socks5h schemes,
+// with optional user:password credentials). Proxies without a scheme are treated as http.
+// All proxies start healthy, Check or StartHealthChecks take the unreachable ones out of rotation.
+func NewProxyPool(proxies []string, tlsConfig *tls.Config) (*ProxyPool, error) {
+	pool := &ProxyPool{stop: make(chan struct{})}
+	for _, p := range sliceutil.Dedupe(proxies) {
+		proxyURL, err := parseProxyURL(p)
+		if err != nil {
+			return nil, err
+		}
+		transport, err := newProxyTransport(proxyURL, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		pp := &poolProxy{url: proxyURL, transport: transport}
+		pp.healthy.Store(true)
+		pool.proxies = append(pool.proxies, pp)
+	}
+	if len(pool.proxies) == 0 {
+		return nil, errors.New("no proxy given")
+	}
+	return pool, nil
+}
+
+// ProxiesFromEnv returns the proxy configured for the api through the HTTPS_PROXY, HTTP_PROXY
+// and NO_PROXY environment variables, following the same rules as http.ProxyFromEnvironment
+func ProxiesFromEnv() []string {
+	apiURL, err := getURL()
+	if err != nil {
+		return nil
+	}
+	proxyURL, err := httpproxy.FromEnvironment().ProxyFunc()(apiURL)
+	if err != nil || proxyURL == nil {
+		return nil
+	}
+	return []string{proxyURL.String()}
+}
+
+func parseProxyURL(proxyString string) (*url.URL, error) {
+	if !strings.Contains(proxyString, "://") {
+		proxyString = "http://" + proxyString
+	}
+	proxyURL, err := url.Parse(proxyString)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Hostname() == "" {
+		return nil, fmt.Errorf("invalid proxy: %s", proxyString)
+	}
+	return proxyURL, nil
+}
+
+func newProxyTransport(proxyURL *url.URL, tlsConfig *tls.Config) (*http.Transport, error) {
+	switch proxyURL.Scheme {
+	case "http", "https":
+		return &http.Transport{
+			Proxy: http.ProxyURL(proxyURL),
+			OnProxyConnectResponse: func(_ context.Context, _ *url.URL, _ *http.Request, res *http.Response) error {
+				if res.StatusCode != http.StatusOK {
+					return &proxyError{err: fmt.Errorf("proxy connect failed: %s", res.Status)}
+				}
+				return nil
+			},
+			TLSClientConfig: tlsConfig.Clone(),
+		}, nil
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if proxyURL.User != nil {
+			password, _ := proxyURL.User.Password()
+			auth = &proxy.Auth{User: proxyURL.User.Username(), Password: password}
+		}
+		dialer, err := proxy.SOCKS5("tcp", proxyAddress(proxyURL), auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+		contextDialer, ok := dialer.(proxy.ContextDialer)
+		if !ok {
+			return nil, errors.New("socks5 dialer doesn't support contexts")
+		}
+		return &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				conn, err := contextDialer.DialContext(ctx, network, addr)
+				if err != nil && ctx.Err() == nil {
+					return nil, &proxyError{err: err}
+				}
+				return conn, err
+			},
+			TLSClientConfig: tlsConfig.Clone(),
+		}, nil
+	default:
+		return nil, fmt.Errorf("invalid proxy scheme: %s", proxyURL.Scheme)
+	}
+}
+
+// proxyAddress returns the proxy host:port, using the scheme default port when missing
+func proxyAddress(proxyURL *url.URL) string {
+	port := proxyURL.Port()
+	if port == "" {
+		switch proxyURL.Scheme {
+		case "https":
+			port = "443"
+		case "socks5", "socks5h":
+			port = "1080"
+		default:
+			port = "80"
+		}
+	}
+	return net.JoinHostPort(proxyURL.Hostname(), port)
+}
+
+// RoundTrip sends the request through the next healthy proxy, moving on to
+// the following one when the proxy can't be reached. Other failures, such as
+// timeouts or errors of the api, are returned as is.
+func (p *ProxyPool) RoundTrip(req *http.Request) (*http.Response, error) {
+	var lastErr error
+	for attempt := 0; attempt < len(p.proxies); attempt++ {
+		pp := p.pick()
+		if pp == nil {
+			break
+		}
+
+		pp.requests.Add(1)
+		pp.mu.RLock()
+		transport := pp.transport
+		pp.mu.RUnlock()
+		res, err := transport.RoundTrip(req)
+		if err == nil && res.StatusCode == http.StatusProxyAuthRequired {
+			_ = res.Body.Close()
+			err = &proxyError{err: errors.New("proxy authentication required")}
+		}
+		if err == nil {
+			return res, nil
+		}
+		if req.Context().Err() != nil || !isProxyError(err) {
+			return nil, err
+		}
+
+		pp.markFailed(err)
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrNoHealthyProxy
+	}
+	return nil, lastErr
+}
+
+// pick returns the next healthy proxy in round robin order
+func (p *ProxyPool) pick() *poolProxy {
+	for range p.proxies {
+		pp := p.proxies[(p.next.Add(1)-1)%uint64(len(p.proxies))]
+		if pp.healthy.Load() {
+			return pp
+		}
+	}
+	return nil
+}
+
+func (pp *poolProxy) markFailed(err error) {
+	pp.failures.Add(1)
+	pp.healthy.Store(false)
+	pp.mu.Lock()
+	pp.lastErr = err
+	pp.mu.Unlock()
+}
+
+// Check dials every proxy, updates their health and returns how many are healthy
+func (p *ProxyPool) Check() int {
+	var (
+		wg      sync.WaitGroup
+		healthy atomic.Int64
+	)
+	for _, pp := range p.proxies {
+		wg.Add(1)
+		go func(pp *poolProxy) {
+			defer wg.Done()
+			conn, err := net.DialTimeout("tcp", proxyAddress(pp.url), proxyDialTimeout)
+			if err != nil {
+				pp.healthy.Store(false)
+				pp.mu.Lock()
+				pp.lastErr = err
+				pp.mu.Unlock()
+				return
+			}
+			_ = conn.Close()
+			pp.healthy.Store(true)
+			healthy.Add(1)
+		}(pp)
+	}
+	wg.Wait()
+	return int(healthy.Load())
+}
+
+// StartHealthChecks periodically re-checks all proxies until Close is called
+func (p *ProxyPool) StartHealthChecks(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				p.Check()
+			}
+		}
+	}()
+}
+
+// Healthy returns the number of proxies currently marked healthy
+func (p *ProxyPool) Healthy() int {
+	var healthy int
+	for _, pp := range p.proxies {
+		if pp.healthy.Load() {
+			healthy++
+		}
+	}
+	return healthy
+}
+
+// Len returns the number of proxies in the pool
+func (p *ProxyPool) Len() int {
+	return len(p.proxies)
+}
+
+// Stats returns per proxy usage statistics, credentials are redacted from the urls
+func (p *ProxyPool) Stats() []ProxyStats {
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, pp := range p.proxies {
+		stat := ProxyStats{
+			URL:      pp.url.Redacted(),
+			Healthy:  pp.healthy.Load(),
+			Requests: pp.requests.Load(),
+			Failures: pp.failures.Load(),
+		}
+		pp.mu.RLock()
+		if pp.lastErr != nil {
+			stat.LastError = pp.lastErr.Error()
+		}
+		pp.mu.RUnlock()
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// setTLSConfig rebuilds the proxy transports with the given tls configuration
+func (p *ProxyPool) setTLSConfig(tlsConfig *tls.Config) error {
+	for _, pp := range p.proxies {
+		transport, err := newProxyTransport(pp.url, tlsConfig)
+		if err != nil {
+			return err
+		}
+		pp.mu.Lock()
+		pp.transport.CloseIdleConnections()
+		pp.transport = transport
+		pp.mu.Unlock()
+	}
+	return nil
+}
+
+// Close stops the health checks and closes idle proxy connections
+func (p *ProxyPool) Close() {
+	p.stopOnce.Do(func() {
+		close(p.stop)
+	})
+	for _, pp := range p.proxies {
+		pp.mu.RLock()
+		pp.transport.CloseIdleConnections()
+		pp.mu.RUnlock()
+	}
+}
+
+// compile time check that the pool can be used as a transport
+var _ http.RoundTripper = (*ProxyPool)(nil)
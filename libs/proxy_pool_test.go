@@ -0,0 +1,176 @@
+package asnmap
+
+import (
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestProxy starts a forward http proxy answering every request itself
+func newTestProxy(t *testing.T, hits *atomic.Int64, credentials string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if credentials != "" && req.Header.Get("Proxy-Authorization") != "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)) {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		hits.Add(1)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestProxyPool(t *testing.T) {
+	t.Setenv("SERVER_URL", "http://asnmap.invalid")
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	var hitsA, hitsB atomic.Int64
+	proxyA := newTestProxy(t, &hitsA, "")
+	proxyB := newTestProxy(t, &hitsB, "user:secret")
+
+	// reserve an address nobody listens on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	deadProxy := "http://" + listener.Addr().String()
+	require.Nil(t, listener.Close())
+
+	authProxyB := "http://user:secret@" + proxyB.Listener.Addr().String()
+
+	t.Run("rotation", func(t *testing.T) {
+		hitsA.Store(0)
+		hitsB.Store(0)
+		client, err := NewClient()
+		require.Nil(t, err)
+		pool, err := client.SetProxyPool([]string{proxyA.URL, authProxyB, deadProxy})
+		require.Nil(t, err)
+		defer pool.Close()
+		require.Equal(t, 2, pool.Healthy())
+
+		for i := 0; i < 4; i++ {
+			_, err := client.GetData("AS14421")
+			require.Nil(t, err)
+		}
+		require.Equal(t, int64(2), hitsA.Load())
+		require.Equal(t, int64(2), hitsB.Load())
+
+		for _, stat := range pool.Stats() {
+			require.NotContains(t, stat.URL, "secret")
+		}
+	})
+
+	t.Run("failing proxy marked unhealthy", func(t *testing.T) {
+		hitsA.Store(0)
+		client, err := NewClient()
+		require.Nil(t, err)
+		// wrong credentials make proxy B fail every request
+		pool, err := client.SetProxyPool([]string{"http://user:wrong@" + proxyB.Listener.Addr().String(), proxyA.URL})
+		require.Nil(t, err)
+		defer pool.Close()
+
+		for i := 0; i < 3; i++ {
+			_, err := client.GetData("AS14421")
+			require.Nil(t, err)
+		}
+		require.Equal(t, int64(3), hitsA.Load())
+
+		stats := pool.Stats()
+		require.False(t, stats[0].Healthy)
+		require.Equal(t, int64(1), stats[0].Failures)
+		require.NotEmpty(t, stats[0].LastError)
+		require.True(t, stats[1].Healthy)
+		require.Equal(t, 1, pool.Healthy())
+
+		// a health check brings the reachable proxy back
+		require.Equal(t, 2, pool.Check())
+	})
+
+	t.Run("api failures keep the proxy healthy", func(t *testing.T) {
+		// the proxy is reachable but the upstream connection drops
+		dropping := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				_ = conn.Close()
+			}
+		}))
+		defer dropping.Close()
+
+		client, err := NewClient()
+		require.Nil(t, err)
+		pool, err := client.SetProxyPool([]string{dropping.URL})
+		require.Nil(t, err)
+		defer pool.Close()
+
+		_, err = client.GetData("AS14421")
+		require.NotNil(t, err)
+		stats := pool.Stats()
+		require.True(t, stats[0].Healthy)
+		require.Zero(t, stats[0].Failures)
+	})
+
+	t.Run("unreachable proxy marked unhealthy", func(t *testing.T) {
+		hitsA.Store(0)
+		client, err := NewClient()
+		require.Nil(t, err)
+		pool, err := client.SetProxyPool([]string{proxyA.URL, deadProxy})
+		require.Nil(t, err)
+		defer pool.Close()
+		// the proxy went down after the health check
+		pool.proxies[1].healthy.Store(true)
+
+		for i := 0; i < 2; i++ {
+			_, err := client.GetData("AS14421")
+			require.Nil(t, err)
+		}
+		require.Equal(t, int64(2), hitsA.Load())
+		require.False(t, pool.Stats()[1].Healthy)
+		require.Equal(t, int64(1), pool.Stats()[1].Failures)
+	})
+
+	t.Run("no reachable proxy", func(t *testing.T) {
+		client, err := NewClient()
+		require.Nil(t, err)
+		_, err = client.SetProxyPool([]string{deadProxy})
+		require.NotNil(t, err)
+	})
+
+	t.Run("single proxy", func(t *testing.T) {
+		hitsA.Store(0)
+		client, err := NewClient()
+		require.Nil(t, err)
+		proxyURL, err := client.SetProxy([]string{deadProxy, proxyA.URL})
+		require.Nil(t, err)
+		require.Equal(t, proxyA.URL, proxyURL.String())
+		_, err = client.GetData("AS14421")
+		require.Nil(t, err)
+		require.Equal(t, int64(1), hitsA.Load())
+	})
+
+	t.Run("invalid proxy", func(t *testing.T) {
+		_, err := NewProxyPool([]string{"ftp://127.0.0.1:21"}, nil)
+		require.NotNil(t, err)
+	})
+
+	t.Run("environment", func(t *testing.T) {
+		t.Setenv("HTTPS_PROXY", "socks5://127.0.0.1:1080")
+		t.Setenv("HTTP_PROXY", "127.0.0.1:8080")
+		t.Setenv("NO_PROXY", "")
+		// the api url is plain http in tests
+		require.Equal(t, []string{"http://127.0.0.1:8080"}, ProxiesFromEnv())
+
+		pool, err := NewProxyPool(ProxiesFromEnv(), defaultTLSConfig())
+		require.Nil(t, err)
+		require.Equal(t, 1, pool.Len())
+		// pools are usable before the first health check
+		require.Equal(t, 1, pool.Healthy())
+
+		t.Setenv("NO_PROXY", ".invalid")
+		require.Empty(t, ProxiesFromEnv())
+	})
+}
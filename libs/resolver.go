@@ -1,18 +1,28 @@
 package asnmap
 
 import (
+	"fmt"
+
 	"github.com/projectdiscovery/retryabledns"
+	sliceutil "github.com/projectdiscovery/utils/slice"
 )
 
 var resolvers = []string{"8.8.8.8:53", "8.8.4.4:53"}
 var max_retries = 2
 
 func ResolveDomain(domain string, customresolvers ...string) ([]string, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
 	// it requires a list of resolvers
 	if len(customresolvers) == 0 {
 		customresolvers = resolvers
 	}
-	dnsClient, _ := retryabledns.New(customresolvers, max_retries)
+	dnsClient, err := retryabledns.New(customresolvers, max_retries)
+	if err != nil {
+		return nil, err
+	}
 	var list []string
 
 	ips, err := dnsClient.A(domain)
@@ -28,3 +38,46 @@ func ResolveDomain(domain string, customresolvers ...string) ([]string, error) {
 	list = append(list, ipA4.AAAA...)
 	return list, nil
 }
+
+// ResolveMX resolves the mail servers of the domain to their ips. Domains without
+// MX records are resolved directly as their own mail server (RFC 5321 implicit MX).
+func ResolveMX(domain string, customresolvers ...string) ([]string, error) {
+	domain, err := NormalizeDomain(domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(customresolvers) == 0 {
+		customresolvers = resolvers
+	}
+	dnsClient, err := retryabledns.New(customresolvers, max_retries)
+	if err != nil {
+		return nil, err
+	}
+	mx, err := dnsClient.MX(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts := mx.MX
+	if len(hosts) == 0 {
+		hosts = []string{domain}
+	}
+	var list []string
+	for _, host := range hosts {
+		ips, err := ResolveDomain(host, customresolvers...)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, ips...)
+	}
+	return sliceutil.Dedupe(list), nil
+}
+
+// ResolveEmail resolves the mail servers of the email address domain to their ips
+func ResolveEmail(email string, customresolvers ...string) ([]string, error) {
+	domain := EmailDomain(email)
+	if domain == "" {
+		return nil, fmt.Errorf("invalid email: %s", email)
+	}
+	return ResolveMX(domain, customresolvers...)
+}
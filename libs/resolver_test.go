@@ -3,32 +3,78 @@ package asnmap
 import (
 	"testing"
 
-	"github.com/projectdiscovery/gologger"
 	"github.com/stretchr/testify/require"
 )
 
 func TestResolveDomain(t *testing.T) {
+	server, err := NewStubDNSServer(DNSRecords{
+		A: map[string][]string{
+			"example.com":     {"93.184.216.34"},
+			"edge.cdn.net":    {"104.16.99.52", "104.16.100.52"},
+			"v4only.test.com": {"10.0.0.1"},
+		},
+		AAAA: map[string][]string{
+			"example.com": {"2606:2800:220:1:248:1893:25c8:1946"},
+		},
+		CNAME: map[string]string{
+			"www.example.org": "edge.cdn.net",
+		},
+	})
+	require.Nil(t, err)
+	defer server.Close()
+
 	tt := []struct {
-		name            string
-		domain          string
-		customresolvers []string
-		expectedOutput  []string
+		name           string
+		domain         string
+		expectedOutput []string
 	}{
-		{"Resolve google.com using default resolvers", "google.com", []string{}, []string{"142.250.183.110"}},
-		{"Resolve google.com using custom resolvers", "google.com", []string{"8.8.8.8"}, []string{"142.250.199.142"}},
-		{"Resolve random domain name using custom resolvers", "somerandomdomainnamethatisfake.com", []string{"8.8.8.8"}, []string{}},
+		{"Resolve A and AAAA records", "example.com", []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946"}},
+		{"Resolve through CNAME", "www.example.org", []string{"104.16.99.52", "104.16.100.52"}},
+		{"Resolve case insensitive name", "V4ONLY.test.com", []string{"10.0.0.1"}},
+		{"Resolve unknown domain", "somerandomdomainnamethatisfake.com", nil},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
-			i, err := ResolveDomain(tc.domain, tc.customresolvers...)
+			i, err := ResolveDomain(tc.domain, server.Addr())
 			require.Nil(t, err)
-			gologger.Info().Msgf("%v resolve to %v", tc.domain, i)
+			require.ElementsMatch(t, tc.expectedOutput, i)
+		})
+	}
+}
+
+func TestResolveEmail(t *testing.T) {
+	server, err := NewStubDNSServer(DNSRecords{
+		A: map[string][]string{
+			"mx1.example.com":  {"192.0.2.10"},
+			"mx2.example.com":  {"192.0.2.11"},
+			"nomx.example.net": {"198.51.100.5"},
+		},
+		MX: map[string][]string{
+			"example.com": {"mx1.example.com", "mx2.example.com"},
+		},
+	})
+	require.Nil(t, err)
+	defer server.Close()
 
-			// If we are unable to resolve the domain, then ResolveDomain() returns an empty list
-			// So for some unregistered domain, we will get an empty list.
-			// Here we are not comparing the exact response for domain as IPs might get change in future.
-			// Instead we are checking whether we are able to resolve domain to some IP or not.
-			require.Falsef(t, len(i) == 0 && tc.domain != "somerandomdomainnamethatisfake.com", "Failed to resolve domain for test case: %v", tc.name)
+	tt := []struct {
+		name           string
+		email          string
+		expectedOutput []string
+		err            bool
+	}{
+		{"Resolve mx hosts", "security@example.com", []string{"192.0.2.10", "192.0.2.11"}, false},
+		{"Fallback to implicit mx", "info@nomx.example.net", []string{"198.51.100.5"}, false},
+		{"Invalid email", "not-an-email", nil, true},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			i, err := ResolveEmail(tc.email, server.Addr())
+			if tc.err {
+				require.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			require.ElementsMatch(t, tc.expectedOutput, i)
 		})
 	}
 }
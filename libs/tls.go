@@ -0,0 +1,109 @@
+package asnmap
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// TLSOptions configures how the client verifies the asnmap server
+type TLSOptions struct {
+	// Insecure disables certificate verification
+	Insecure bool
+	// CAFile is a PEM bundle of CAs trusted in addition to the system roots
+	CAFile string
+	// ClientCertFile and ClientKeyFile are the PEM encoded certificate and key used for mTLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// PinnedSPKI is a list of base64 encoded sha256 hashes of the server SubjectPublicKeyInfo,
+	// optionally prefixed with "sha256/". One of the presented certificates must match.
+	PinnedSPKI []string
+}
+
+// defaultTLSConfig verifies the server certificate against the system roots
+func defaultTLSConfig() *tls.Config {
+	return &tls.Config{MinVersion: tls.VersionTLS12}
+}
+
+// NewTLSConfig builds a tls configuration from the given options
+func NewTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	cfg := defaultTLSConfig()
+	cfg.InsecureSkipVerify = opts.Insecure
+
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in ca file '%s'", opts.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if opts.ClientCertFile != "" || opts.ClientKeyFile != "" {
+		if opts.ClientCertFile == "" || opts.ClientKeyFile == "" {
+			return nil, errors.New("both client certificate and key are required for mtls")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if len(opts.PinnedSPKI) > 0 {
+		pins := make(map[string]struct{}, len(opts.PinnedSPKI))
+		for _, pin := range opts.PinnedSPKI {
+			pin = strings.TrimPrefix(strings.TrimSpace(pin), "sha256/")
+			if decoded, err := base64.StdEncoding.DecodeString(pin); err != nil || len(decoded) != sha256.Size {
+				return nil, fmt.Errorf("invalid spki pin '%s': expected base64 encoded sha256 hash", pin)
+			}
+			pins[pin] = struct{}{}
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			for _, cert := range cs.PeerCertificates {
+				if _, ok := pins[SPKIHash(cert)]; ok {
+					return nil
+				}
+			}
+			return errors.New("server certificate doesn't match any pinned public key")
+		}
+	}
+
+	return cfg, nil
+}
+
+// SPKIHash returns the base64 encoded sha256 hash of the certificate SubjectPublicKeyInfo
+func SPKIHash(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SetTLSOptions configures certificate verification for all api requests
+func (c *Client) SetTLSOptions(opts TLSOptions) error {
+	cfg, err := NewTLSConfig(opts)
+	if err != nil {
+		return err
+	}
+	c.tlsConfig = cfg
+	switch transport := c.transport.(type) {
+	case *http.Transport:
+		transport = transport.Clone()
+		transport.TLSClientConfig = cfg.Clone()
+		c.setTransport(transport)
+	case *ProxyPool:
+		return transport.setTLSConfig(cfg)
+	}
+	return nil
+}
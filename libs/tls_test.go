@@ -0,0 +1,100 @@
+package asnmap
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientTLSVerification(t *testing.T) {
+	var clientCerts int
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clientCerts = len(req.TLS.PeerCertificates)
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequestClientCert}
+	server.StartTLS()
+	defer server.Close()
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := PDCPApiKey
+	PDCPApiKey = "test-api-key"
+	defer func() { PDCPApiKey = apiKey }()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	require.Nil(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600))
+	certFile, keyFile := writeClientCert(t, dir)
+
+	tt := []struct {
+		name        string
+		opts        TLSOptions
+		err         bool
+		clientCerts int
+	}{
+		{"untrusted by default", TLSOptions{}, true, 0},
+		{"custom ca", TLSOptions{CAFile: caFile}, false, 0},
+		{"insecure", TLSOptions{Insecure: true}, false, 0},
+		{"matching pin", TLSOptions{CAFile: caFile, PinnedSPKI: []string{"sha256/" + SPKIHash(server.Certificate())}}, false, 0},
+		{"mismatching pin", TLSOptions{Insecure: true, PinnedSPKI: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}}, true, 0},
+		{"client certificate", TLSOptions{CAFile: caFile, ClientCertFile: certFile, ClientKeyFile: keyFile}, false, 1},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			client, err := NewClient()
+			require.Nil(t, err)
+			require.Nil(t, client.SetTLSOptions(tc.opts))
+
+			_, err = client.GetData("AS14421")
+			if tc.err {
+				require.NotNil(t, err)
+			} else {
+				require.Nil(t, err)
+				require.Equal(t, tc.clientCerts, clientCerts)
+			}
+		})
+	}
+
+	t.Run("invalid options", func(t *testing.T) {
+		_, err := NewTLSConfig(TLSOptions{PinnedSPKI: []string{"not-a-hash"}})
+		require.NotNil(t, err)
+		_, err = NewTLSConfig(TLSOptions{ClientCertFile: certFile})
+		require.NotNil(t, err)
+		_, err = NewTLSConfig(TLSOptions{CAFile: filepath.Join(dir, "missing.pem")})
+		require.NotNil(t, err)
+	})
+}
+
+// writeClientCert generates a self-signed client certificate and returns the cert and key paths
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "asnmap-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.Nil(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	require.Nil(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.Nil(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+	return certFile, keyFile
+}
@@ -1,7 +1,11 @@
 package asnmap
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
 	"net"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
@@ -19,6 +23,10 @@ type Result struct {
 	ASN_org    string   `json:"as_name" csv:"as_name"`
 	AS_country string   `json:"as_country" csv:"as_country"`
 	AS_range   []string `json:"as_range" csv:"as_range"`
+	InputType  string   `json:"input_type,omitempty" csv:"input_type"`
+	Annotation string   `json:"annotation,omitempty" csv:"-"`
+	// Record is the original json record the input was extracted from
+	Record json.RawMessage `json:"record,omitempty" csv:"-"`
 }
 
 // To model http response from server
@@ -26,17 +34,37 @@ type Response struct {
 	FirstIp string `json:"first_ip,omitempty"`
 	LastIp  string `json:"last_ip,omitempty"`
 	Input   string `json:"-"` // added by client
-	ASN     int    `json:"asn,omitempty"`
-	Country string `json:"country,omitempty"`
-	Org     string `json:"org,omitempty"`
+	// InputType is the name of the type the input was looked up as (see InputType.String)
+	InputType string `json:"-"` // added by client
+	ASN       int    `json:"asn,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Org       string `json:"org,omitempty"`
+	// Annotation explains why the input was answered without an api lookup
+	Annotation string `json:"-"` // added by client
+	// Record is the original json record the input was extracted from
+	Record string `json:"-"` // added by runner
 }
 
 func (r Response) Equal(r2 Response) bool {
 	return r.ASN == r2.ASN && strings.EqualFold(r.Org, r2.Org)
 }
 
+// Contains checks if the given ip falls within the response range
+func (r Response) Contains(ip string) bool {
+	target, first, last := net.ParseIP(ip), net.ParseIP(r.FirstIp), net.ParseIP(r.LastIp)
+	if target == nil || first == nil || last == nil {
+		return false
+	}
+	// ipv4 and ipv6 ranges never contain each other
+	if (target.To4() == nil) != (first.To4() == nil) {
+		return false
+	}
+	return bytes.Compare(target.To16(), first.To16()) >= 0 && bytes.Compare(target.To16(), last.To16()) <= 0
+}
+
 type InputType uint8
 
+// new input types are appended to keep the values of the existing ones
 const (
 	ASN InputType = iota
 	ASNID
@@ -44,8 +72,45 @@ const (
 	Org
 	Domain
 	Unknown
+	CIDR
+	IPRange
+	ASNRange
+	URL
+	Email
 )
 
+var inputTypeNames = map[InputType]string{
+	ASN:      "asn",
+	ASNID:    "asn",
+	IP:       "ip",
+	Org:      "org",
+	Domain:   "domain",
+	CIDR:     "cidr",
+	IPRange:  "ip_range",
+	ASNRange: "asn_range",
+	URL:      "url",
+	Email:    "email",
+	Unknown:  "unknown",
+}
+
+func (t InputType) String() string {
+	if name, ok := inputTypeNames[t]; ok {
+		return name
+	}
+	return inputTypeNames[Unknown]
+}
+
+// ParseInputType returns the input type with the given name (as returned by InputType.String)
+func ParseInputType(name string) (InputType, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for inputType, typeName := range inputTypeNames {
+		if typeName == name && inputType != ASNID && inputType != Unknown {
+			return inputType, nil
+		}
+	}
+	return Unknown, fmt.Errorf("unknown input type '%s'", name)
+}
+
 var domainRegex = regexp.MustCompile(`^(?i)[a-z0-9-_]+(\.[a-z0-9-]+)+\.?$`)
 
 func MapToResults(output []*Response) ([]*Result, error) {
@@ -64,9 +129,17 @@ func mapToResult(resp *Response) (*Result, error) {
 	result := &Result{}
 	result.Timestamp = time.Now().Local().String()
 	result.Input = attachPrefix(resp.Input)
-	result.ASN = attachPrefix(strconv.Itoa(resp.ASN))
+	// annotated inputs were answered locally and have no owning asn
+	if resp.Annotation == "" {
+		result.ASN = attachPrefix(strconv.Itoa(resp.ASN))
+	}
 	result.ASN_org = resp.Org
 	result.AS_country = resp.Country
+	result.Annotation = resp.Annotation
+	if resp.Record != "" {
+		result.Record = json.RawMessage(resp.Record)
+	}
+	result.InputType = resp.InputType
 	cidrs, err := GetCIDR([]*Response{resp})
 	if err != nil {
 		return nil, err
@@ -102,7 +175,7 @@ func checkIfASN(input string) bool {
 	if hasASNPrefix {
 		input = input[2:]
 	}
-	return hasASNPrefix && checkIfASNId(input)
+	return hasASNPrefix && (checkIfASNId(input) || checkIfASDot(input))
 }
 
 func checkIfASNId(input string) bool {
@@ -113,17 +186,78 @@ func checkIfASNId(input string) bool {
 	return hasNumericId
 }
 
+func checkIfURL(input string) bool {
+	return strings.Contains(input, "://") && HostFromURL(input) != ""
+}
+
+func checkIfEmail(input string) bool {
+	return EmailDomain(input) != ""
+}
+
+// HostFromURL returns the host of the url without port, or an empty string for invalid urls
+func HostFromURL(input string) string {
+	u, err := url.Parse(input)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// EmailDomain returns the domain of the email address, or an empty string for invalid addresses
+func EmailDomain(input string) string {
+	idx := strings.LastIndex(input, "@")
+	if idx <= 0 || strings.ContainsAny(input[:idx], " \t") {
+		return ""
+	}
+	domain := input[idx+1:]
+	if !checkIfDomain(domain) {
+		return ""
+	}
+	return domain
+}
+
+// inputClassifiers are checked in order, the first matching one decides the input type
+var inputClassifiers = []struct {
+	inputType InputType
+	check     func(string) bool
+	reason    string
+}{
+	{IP, iputil.IsIP, "valid ipv4 or ipv6 address"},
+	{ASN, checkIfASN, "'AS' prefix followed by an asplain or asdot number"},
+	{ASNID, checkIfASNId, "numeric value, treated as asn"},
+	{ASNRange, checkIfASNRange, "range of two asns"},
+	{CIDR, checkIfCIDR, "valid cidr notation"},
+	{IPRange, checkIfIPRange, "range of two ips of the same family"},
+	{URL, checkIfURL, "url with scheme and host"},
+	{Email, checkIfEmail, "email address with a valid domain"},
+	{Domain, checkIfDomain, "matches the domain name pattern"},
+}
+
 func IdentifyInput(input string) InputType {
-	switch {
-	case iputil.IsIP(input):
-		return IP
-	case checkIfASN(input):
-		return ASN
-	case checkIfASNId(input):
-		return ASNID
-	case domainRegex.MatchString(input):
-		return Domain
-	default:
-		return Org
+	inputType, _ := ExplainInput(input)
+	return inputType
+}
+
+// ExplainInput identifies the input type and returns the reason it was chosen
+func ExplainInput(input string) (InputType, string) {
+	for _, classifier := range inputClassifiers {
+		if classifier.check(input) {
+			return classifier.inputType, classifier.reason
+		}
+	}
+	return Org, "no other input type matched, treated as organization name"
+}
+
+// ParseTypePrefix splits an explicitly typed input such as "org:AS Networks" or
+// "domain:1password.com" into the input and its type
+func ParseTypePrefix(input string) (string, InputType, bool) {
+	typeName, value, ok := strings.Cut(input, ":")
+	if !ok || value == "" {
+		return input, Unknown, false
+	}
+	inputType, err := ParseInputType(typeName)
+	if err != nil {
+		return input, Unknown, false
 	}
+	return strings.TrimSpace(value), inputType, true
 }
@@ -14,6 +14,8 @@ func TestIdentifyInput(t *testing.T) {
 	}{
 		{"IP", "10.101.101.10", IP},
 		{"ASN", "AS14421", ASN},
+		{"ASN in asdot notation", "AS1.10", ASN},
+		{"ASN range", "AS64500-AS64510", ASNRange},
 		{"Org", "PPLINKNET", Org},
 		{"Org", "AS", Org},
 		{"Org", "AS-CHOOPA", Org},
@@ -23,6 +25,17 @@ func TestIdentifyInput(t *testing.T) {
 		{"Third level domain", "bigstuff.cornell.edu", Domain},
 		{"Fourth level domain", "www.bass.blm.gov", Domain},
 		{"Domain with number", "www.99acres.com", Domain},
+		{"Internationalised domain", "münchen.de", Domain},
+		{"Punycode domain", "xn--mnchen-3ya.de", Domain},
+		{"Unicode org", "Société Générale", Org},
+		{"Internationalised email", "info@münchen.de", Email},
+		{"CIDR", "1.2.3.0/22", CIDR},
+		{"IPv6 CIDR", "2405:aa00::/32", CIDR},
+		{"IP range", "1.2.3.4-1.2.5.9", IPRange},
+		{"URL", "https://x.example.com:8443/path", URL},
+		{"URL with ip host", "http://10.101.101.10/", URL},
+		{"Email", "security@example.com", Email},
+		{"Org with at sign", "AT&T @ Home", Org},
 	}
 
 	for _, tc := range tt {
@@ -75,3 +88,71 @@ func TestMapToResults(t *testing.T) {
 		})
 	}
 }
+
+func TestResponseContains(t *testing.T) {
+	v4 := Response{FirstIp: "216.101.17.0", LastIp: "216.101.17.255"}
+	v6 := Response{FirstIp: "2405:aa00::", LastIp: "2405:aa00:ffff:ffff:ffff:ffff:ffff:ffff"}
+
+	require.True(t, v4.Contains("216.101.17.0"))
+	require.True(t, v4.Contains("216.101.17.128"))
+	require.True(t, v4.Contains("216.101.17.255"))
+	require.False(t, v4.Contains("216.101.18.0"))
+	require.False(t, v4.Contains("::ffff:0"))
+	require.False(t, v4.Contains("not-an-ip"))
+	require.True(t, v6.Contains("2405:aa00::1"))
+	require.False(t, v6.Contains("216.101.17.1"))
+}
+
+func TestInputTypeNames(t *testing.T) {
+	for _, inputType := range []InputType{ASN, IP, Org, Domain, CIDR, IPRange, ASNRange, URL, Email} {
+		parsed, err := ParseInputType(inputType.String())
+		require.Nil(t, err)
+		require.Equal(t, inputType, parsed)
+	}
+	require.Equal(t, "asn", ASNID.String())
+
+	_, err := ParseInputType("unknown")
+	require.NotNil(t, err)
+	_, err = ParseInputType("hostname")
+	require.NotNil(t, err)
+}
+
+func TestParseTypePrefix(t *testing.T) {
+	tt := []struct {
+		input        string
+		expected     string
+		expectedType InputType
+		ok           bool
+	}{
+		{"org:AS Networks", "AS Networks", Org, true},
+		{"domain:1password.com", "1password.com", Domain, true},
+		{"ip:2a10:ad40::", "2a10:ad40::", IP, true},
+		{"ASN:AS14421", "AS14421", ASN, true},
+		{"2a10:ad40::", "2a10:ad40::", Unknown, false},
+		{"https://example.com", "https://example.com", Unknown, false},
+		{"org:", "org:", Unknown, false},
+	}
+	for _, tc := range tt {
+		t.Run(tc.input, func(t *testing.T) {
+			value, inputType, ok := ParseTypePrefix(tc.input)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.expected, value)
+			require.Equal(t, tc.expectedType, inputType)
+		})
+	}
+}
+
+func TestExplainInput(t *testing.T) {
+	inputType, reason := ExplainInput("AS")
+	require.Equal(t, Org, inputType)
+	require.Contains(t, reason, "organization")
+
+	inputType, reason = ExplainInput("bbc.co.uk")
+	require.Equal(t, Domain, inputType)
+	require.Contains(t, reason, "domain")
+}
+
+func TestInputTypeValues(t *testing.T) {
+	// the values of the original input types are part of the public api
+	require.Equal(t, []InputType{0, 1, 2, 3, 4, 5}, []InputType{ASN, ASNID, IP, Org, Domain, Unknown})
+}
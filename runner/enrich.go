@@ -0,0 +1,345 @@
+package runner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/projectdiscovery/gologger"
+)
+
+// defaultEnrichFields are the record fields looked up in enrich mode when no -input-field is given
+var defaultEnrichFields = []string{"ip", "host", "a[]"}
+
+// enrichKeys are the keys added to enriched records
+var enrichKeys = []string{"asn", "as_name", "as_country", "as_range"}
+
+// maxRecordSize is the longest line read from stdin or a jsonl file
+const maxRecordSize = 1024 * 1024
+
+// enrichment holds the asn data added to a record
+type enrichment struct {
+	ASN       string   `json:"asn"`
+	ASName    string   `json:"as_name"`
+	ASCountry string   `json:"as_country"`
+	ASRange   []string `json:"as_range"`
+}
+
+// enrich reads jsonl records and writes every record back with the asn data
+// of the first target found in the selected fields
+func (r *Runner) enrich(ctx context.Context, input io.Reader) error {
+	r.stats.reset()
+	var cache responseCache
+	if input != nil {
+		scanner := bufio.NewScanner(input)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+		for scanner.Scan() {
+			if ctx.Err() != nil {
+				return ErrInterrupted
+			}
+			if err := r.enrichLine(scanner.Text(), &cache); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	for _, line := range r.options.FileInput {
+		if ctx.Err() != nil {
+			return ErrInterrupted
+		}
+		if err := r.enrichLine(line, &cache); err != nil {
+			return err
+		}
+	}
+	return r.failedInputsError()
+}
+
+// enrichLine writes a single record, records that aren't json objects or have no
+// matching target are written back unchanged. Client-wide lookup errors are returned.
+func (r *Runner) enrichLine(line string, cache *responseCache) error {
+	raw := bytes.TrimSpace([]byte(line))
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(raw, &record); err != nil || record == nil {
+		gologger.Verbose().Msgf("Could not enrich invalid jsonl record '%s'", line)
+		return r.writeRecord(raw)
+	}
+
+	fields := []string(r.options.InputField)
+	if len(fields) == 0 {
+		fields = defaultEnrichFields
+	}
+	var (
+		response  *asnmap.Response
+		lookupErr error
+		targets   int
+	)
+	for _, selector := range fields {
+		for _, target := range extractFields(record, selector) {
+			targets++
+			var err error
+			if response, err = r.lookupTarget(target, cache); response != nil {
+				break
+			}
+			if isFatalError(err) {
+				return err
+			}
+			if err != nil {
+				lookupErr = fmt.Errorf("could not lookup '%s': %w", target, err)
+			}
+		}
+		if response != nil {
+			break
+		}
+	}
+	if targets > 0 {
+		r.stats.total.Add(1)
+	}
+	if response == nil {
+		// records whose lookups failed are carried through and fail the run
+		if lookupErr != nil {
+			r.stats.failed.Add(1)
+			gologger.Error().Msgf("Could not enrich record '%s': %s", line, lookupErr)
+		}
+		return r.writeRecord(raw)
+	}
+
+	cidrs, err := asnmap.GetCIDR([]*asnmap.Response{response})
+	if err != nil {
+		return err
+	}
+	data := enrichment{
+		ASN:       fmt.Sprintf("AS%d", response.ASN),
+		ASName:    response.Org,
+		ASCountry: response.Country,
+		ASRange:   make([]string, 0, len(cidrs)),
+	}
+	for _, cidr := range cidrs {
+		data.ASRange = append(data.ASRange, cidr.String())
+	}
+
+	enriched, err := appendEnrichment(raw, record, data)
+	if err != nil {
+		return err
+	}
+	return r.writeRecord(enriched)
+}
+
+// lookupTarget returns the response owning an ip, or the first resolved ip of a host.
+// Ips within an already returned range are answered from the cache. Targets without an
+// owner return no response and no error.
+func (r *Runner) lookupTarget(target string, cache *responseCache) (*asnmap.Response, error) {
+	var ips []string
+	switch inputType := asnmap.IdentifyInput(target); inputType {
+	case asnmap.IP:
+		ips = []string{target}
+	case asnmap.Domain, asnmap.URL, asnmap.Email:
+		resolved, err := r.resolve(target, inputType)
+		if err != nil {
+			if r.options.Metrics != nil {
+				r.options.Metrics.Error()
+			}
+			return nil, fmt.Errorf("could not resolve: %w", err)
+		}
+		ips = resolved
+	default:
+		return nil, nil
+	}
+
+	var lookupErr error
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if cached := cache.get(addr.Unmap()); cached != nil {
+			if r.options.Metrics != nil {
+				r.options.Metrics.CacheHit()
+			}
+			response := *cached
+			return &response, nil
+		}
+		responses, err := r.client.GetData(ip)
+		if err != nil {
+			// client-wide errors fail the other ips as well
+			if isFatalError(err) {
+				return nil, err
+			}
+			gologger.Verbose().Msgf("could not lookup '%s': %v", ip, err)
+			lookupErr = err
+			continue
+		}
+		for _, response := range responses {
+			if response.Contains(ip) {
+				cache.add(*response)
+				return response, nil
+			}
+		}
+	}
+	return nil, lookupErr
+}
+
+// lookupReportTarget looks up an ip of the report modes. Failed lookups are logged and counted
+// as failed inputs, only client-wide errors are returned.
+func (r *Runner) lookupReportTarget(target string, cache *responseCache) (*asnmap.Response, error) {
+	r.stats.total.Add(1)
+	response, err := r.lookupTarget(target, cache)
+	if isFatalError(err) {
+		return nil, err
+	}
+	if err != nil {
+		r.stats.failed.Add(1)
+		gologger.Error().Msgf("Could not lookup '%s': %s", target, err)
+		return nil, nil
+	}
+	if response == nil {
+		gologger.Verbose().Msgf("No records found for %v", target)
+	}
+	return response, nil
+}
+
+// responseCache indexes the looked up responses by their range. Ranges are kept sorted and
+// disjoint, the parts of a range already covered by an earlier response are left out.
+type responseCache struct {
+	entries []cacheEntry
+}
+
+type cacheEntry struct {
+	addrRange
+	response *asnmap.Response
+}
+
+// get returns the cached response whose range contains the address
+func (c *responseCache) get(addr netip.Addr) *asnmap.Response {
+	i := sort.Search(len(c.entries), func(i int) bool {
+		return addr.Less(c.entries[i].first)
+	})
+	if i == 0 || c.entries[i-1].last.Less(addr) {
+		return nil
+	}
+	return c.entries[i-1].response
+}
+
+// add caches the response for the addresses of its range not cached yet
+func (c *responseCache) add(response asnmap.Response) {
+	r, err := parseAddrRange(response.FirstIp + "-" + response.LastIp)
+	if err != nil {
+		return
+	}
+
+	var parts []addrRange
+	start := r.first
+	i := sort.Search(len(c.entries), func(i int) bool {
+		return !c.entries[i].last.Less(start)
+	})
+	for ; i < len(c.entries) && !r.last.Less(c.entries[i].first); i++ {
+		if start.Less(c.entries[i].first) {
+			parts = append(parts, addrRange{first: start, last: c.entries[i].first.Prev()})
+		}
+		if !c.entries[i].last.Less(r.last) {
+			start = netip.Addr{}
+			break
+		}
+		start = c.entries[i].last.Next()
+	}
+	if start.IsValid() && !r.last.Less(start) {
+		parts = append(parts, addrRange{first: start, last: r.last})
+	}
+
+	for _, part := range parts {
+		entry := cacheEntry{addrRange: part, response: &response}
+		at := sort.Search(len(c.entries), func(i int) bool {
+			return part.first.Less(c.entries[i].first)
+		})
+		c.entries = append(c.entries, cacheEntry{})
+		copy(c.entries[at+1:], c.entries[at:])
+		c.entries[at] = entry
+	}
+}
+
+// appendEnrichment adds the asn keys to the raw record, keeping the original fields
+// and their order intact. Keys the record already holds are replaced in place.
+func appendEnrichment(raw []byte, record map[string]interface{}, data enrichment) ([]byte, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range enrichKeys {
+		if _, ok := record[key]; ok {
+			return replaceEnrichment(raw, encoded)
+		}
+	}
+
+	body := bytes.TrimSpace(raw[:len(raw)-1])
+	enriched := append([]byte{}, body...)
+	if len(record) > 0 {
+		enriched = append(enriched, ',')
+	}
+	return append(enriched, encoded[1:]...), nil
+}
+
+// replaceEnrichment re-encodes the raw record with the values of the encoded asn keys,
+// existing keys keep their position and the missing ones are appended
+func replaceEnrichment(raw, encoded []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{}, len(fields))
+	enriched := []byte{'{'}
+	appendField := func(key string, value json.RawMessage) {
+		if len(enriched) > 1 {
+			enriched = append(enriched, ',')
+		}
+		name, _ := json.Marshal(key)
+		enriched = append(enriched, name...)
+		enriched = append(enriched, ':')
+		enriched = append(enriched, value...)
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		if replacement, ok := fields[key]; ok {
+			value = replacement
+			seen[key] = struct{}{}
+		}
+		appendField(key, value)
+	}
+	for _, key := range enrichKeys {
+		if _, ok := seen[key]; !ok {
+			appendField(key, fields[key])
+		}
+	}
+	return append(enriched, '}'), nil
+}
+
+func (r *Runner) writeRecord(record []byte) error {
+	if r.options.Output == nil {
+		return nil
+	}
+	_, err := fmt.Fprintf(r.options.Output, "%s\n", record)
+	return err
+}
@@ -0,0 +1,134 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnrich(t *testing.T) {
+	dnsServer, err := asnmap.NewStubDNSServer(asnmap.DNSRecords{
+		A: map[string][]string{
+			"hackerone.com": {"104.16.99.52"},
+		},
+	})
+	require.Nil(t, err)
+	defer dnsServer.Close()
+
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+
+	input := strings.Join([]string{
+		`{"ip":"104.16.99.52","port":443}`,
+		`{"host":"hackerone.com","status":200}`,
+		`{"z":"first","host":"10.0.0.1"}`,
+		`{"ip":"104.16.1.1","asn":"stale"}`,
+		`{"as_range":[],"ip":"104.16.2.1","port":80}`,
+		`not json`,
+		`{}`,
+	}, "\n")
+
+	var buf bytes.Buffer
+	options := &Options{
+		Enrich:    true,
+		Resolvers: []string{dnsServer.Addr()},
+		Output:    &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.enrich(context.Background(), strings.NewReader(input)))
+	require.Nil(t, r.Close())
+
+	require.Equal(t, []string{
+		`{"ip":"104.16.99.52","port":443,"asn":"AS13335","as_name":"cloudflarenet","as_country":"US","as_range":["104.16.0.0/16"]}`,
+		`{"host":"hackerone.com","status":200,"asn":"AS13335","as_name":"cloudflarenet","as_country":"US","as_range":["104.16.0.0/16"]}`,
+		`{"z":"first","host":"10.0.0.1"}`,
+		`{"ip":"104.16.1.1","asn":"AS13335","as_name":"cloudflarenet","as_country":"US","as_range":["104.16.0.0/16"]}`,
+		`{"as_range":["104.16.0.0/16"],"ip":"104.16.2.1","port":80,"asn":"AS13335","as_name":"cloudflarenet","as_country":"US"}`,
+		`not json`,
+		`{}`,
+	}, strings.Split(strings.TrimSpace(buf.String()), "\n"))
+}
+
+func TestEnrichLookupErrors(t *testing.T) {
+	input := `{"ip":"1.1.1.1","x":1}`
+
+	t.Run("unreachable server", func(t *testing.T) {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.Nil(t, err)
+		t.Setenv("SERVER_URL", "http://"+listener.Addr().String())
+		require.Nil(t, listener.Close())
+		apiKey := asnmap.PDCPApiKey
+		asnmap.PDCPApiKey = "test-api-key"
+		t.Cleanup(func() { asnmap.PDCPApiKey = apiKey })
+
+		// records are carried through while the run fails
+		var buf bytes.Buffer
+		r, err := New(&Options{Enrich: true, Output: &buf})
+		require.Nil(t, err)
+		err = r.enrich(context.Background(), strings.NewReader(input))
+		require.ErrorIs(t, err, ErrFailedInputs)
+		require.Equal(t, input+"\n", buf.String())
+		require.EqualValues(t, 1, r.stats.failed.Load())
+		require.Nil(t, r.Close())
+	})
+
+	t.Run("unauthorized", func(t *testing.T) {
+		server := newStubAPIServer(t, nil)
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+
+		var buf bytes.Buffer
+		r, err := New(&Options{Enrich: true, Output: &buf})
+		require.Nil(t, err)
+		err = r.enrich(context.Background(), strings.NewReader(input+"\n"+input))
+		require.ErrorIs(t, err, asnmap.ErrUnAuthorized)
+		require.Empty(t, buf.String())
+		require.Nil(t, r.Close())
+	})
+}
+
+func TestResponseCache(t *testing.T) {
+	var cache responseCache
+	cache.add(asnmap.Response{FirstIp: "20.0.4.0", LastIp: "20.0.4.255", ASN: 2})
+	cache.add(asnmap.Response{FirstIp: "2a00::", LastIp: "2a00::ffff", ASN: 3})
+	// overlapping ranges only cache the addresses not covered yet
+	cache.add(asnmap.Response{FirstIp: "20.0.0.0", LastIp: "20.0.7.255", ASN: 1})
+	cache.add(asnmap.Response{FirstIp: "20.0.4.0", LastIp: "20.0.4.127", ASN: 4})
+	cache.add(asnmap.Response{FirstIp: "invalid", LastIp: "20.0.4.127", ASN: 5})
+
+	tt := []struct {
+		ip  string
+		asn int
+	}{
+		{"20.0.0.0", 1},
+		{"20.0.3.255", 1},
+		{"20.0.4.0", 2},
+		{"20.0.4.200", 2},
+		{"20.0.5.0", 1},
+		{"20.0.7.255", 1},
+		{"2a00::1", 3},
+		{"19.255.255.255", 0},
+		{"20.0.8.0", 0},
+		{"2a00::1:0", 0},
+	}
+	for _, tc := range tt {
+		response := cache.get(netip.MustParseAddr(tc.ip))
+		if tc.asn == 0 {
+			require.Nil(t, response, tc.ip)
+			continue
+		}
+		require.NotNil(t, response, tc.ip)
+		require.Equal(t, tc.asn, response.ASN, tc.ip)
+	}
+	require.Len(t, cache.entries, 4)
+}
@@ -0,0 +1,178 @@
+package runner
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+)
+
+// countryCodeRegex matches two letter country codes, which are excluded by country
+// unless declared otherwise
+var countryCodeRegex = regexp.MustCompile(`^[A-Za-z]{2}$`)
+
+// exclusions holds the networks, asns, orgs and countries left out of the output
+type exclusions struct {
+	// networks are sorted by their first address
+	networks  []addrRange
+	asns      [][2]uint32
+	orgs      []*regexp.Regexp
+	countries map[string]struct{}
+}
+
+// addrRange is an inclusive range of addresses of the same family
+type addrRange struct {
+	first, last netip.Addr
+}
+
+// parseExclusions parses the -exclude entries. Entries are classified like inputs and can
+// be declared with the same prefixes, plus "country:". Two letter entries are country codes,
+// org patterns match the whole name case-insensitively with * as wildcard.
+func parseExclusions(entries []string) (*exclusions, error) {
+	excluded := &exclusions{countries: make(map[string]struct{})}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+
+		if typeName, value, ok := strings.Cut(entry, ":"); ok && strings.EqualFold(typeName, "country") {
+			if !countryCodeRegex.MatchString(strings.TrimSpace(value)) {
+				return nil, fmt.Errorf("invalid excluded country code '%s'", value)
+			}
+			excluded.countries[strings.ToUpper(strings.TrimSpace(value))] = struct{}{}
+			continue
+		}
+		value, inputType, declared := asnmap.ParseTypePrefix(entry)
+		if !declared {
+			inputType = asnmap.IdentifyInput(value)
+			if inputType == asnmap.Org && countryCodeRegex.MatchString(value) {
+				excluded.countries[strings.ToUpper(value)] = struct{}{}
+				continue
+			}
+		}
+
+		switch inputType {
+		case asnmap.IP, asnmap.CIDR, asnmap.IPRange:
+			network, err := parseAddrRange(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid excluded network '%s': %w", value, err)
+			}
+			excluded.networks = append(excluded.networks, network)
+		case asnmap.ASN, asnmap.ASNID:
+			asn, err := asnmap.ParseASN(value)
+			if err != nil {
+				return nil, err
+			}
+			excluded.asns = append(excluded.asns, [2]uint32{asn, asn})
+		case asnmap.ASNRange:
+			first, last, err := asnmap.ParseASNRange(value)
+			if err != nil {
+				return nil, err
+			}
+			excluded.asns = append(excluded.asns, [2]uint32{first, last})
+		case asnmap.Org:
+			pattern := strings.ReplaceAll(regexp.QuoteMeta(value), `\*`, ".*")
+			org, err := regexp.Compile("(?i)^" + pattern + "$")
+			if err != nil {
+				return nil, err
+			}
+			excluded.orgs = append(excluded.orgs, org)
+		default:
+			return nil, fmt.Errorf("unsupported exclusion '%s': expected a cidr, ip range, asn, org or country code", entry)
+		}
+	}
+
+	sort.Slice(excluded.networks, func(i, j int) bool {
+		return excluded.networks[i].first.Less(excluded.networks[j].first)
+	})
+	return excluded, nil
+}
+
+// parseAddrRange parses an ip, cidr or ip range
+func parseAddrRange(value string) (addrRange, error) {
+	if addr, err := netip.ParseAddr(value); err == nil {
+		return addrRange{first: addr.Unmap(), last: addr.Unmap()}, nil
+	}
+	first, last, err := asnmap.ParseIPRange(value)
+	if err != nil {
+		return addrRange{}, err
+	}
+	return addrRange{first: first.Unmap(), last: last.Unmap()}, nil
+}
+
+// apply drops the responses of excluded asns, orgs and countries and subtracts the excluded
+// networks from the remaining ranges. Partially excluded ranges are split into one response
+// per remaining part. Responses without a range are only dropped by their asn, org or country.
+func (e *exclusions) apply(responses []*asnmap.Response) []*asnmap.Response {
+	filtered := make([]*asnmap.Response, 0, len(responses))
+	for _, response := range responses {
+		if e.excludes(response) {
+			continue
+		}
+		if response.FirstIp == "" {
+			filtered = append(filtered, response)
+			continue
+		}
+
+		first, errFirst := netip.ParseAddr(response.FirstIp)
+		last, errLast := netip.ParseAddr(response.LastIp)
+		if errFirst != nil || errLast != nil {
+			filtered = append(filtered, response)
+			continue
+		}
+		parts := e.subtract(addrRange{first: first.Unmap(), last: last.Unmap()})
+		if len(parts) == 1 && parts[0].first == first.Unmap() && parts[0].last == last.Unmap() {
+			filtered = append(filtered, response)
+			continue
+		}
+		for _, part := range parts {
+			split := *response
+			split.FirstIp = part.first.String()
+			split.LastIp = part.last.String()
+			filtered = append(filtered, &split)
+		}
+	}
+	return filtered
+}
+
+// excludes reports whether the response belongs to an excluded asn, org or country
+func (e *exclusions) excludes(response *asnmap.Response) bool {
+	for _, asns := range e.asns {
+		if uint32(response.ASN) >= asns[0] && uint32(response.ASN) <= asns[1] {
+			return true
+		}
+	}
+	for _, org := range e.orgs {
+		if org.MatchString(response.Org) {
+			return true
+		}
+	}
+	_, ok := e.countries[strings.ToUpper(response.Country)]
+	return ok && response.Country != ""
+}
+
+// subtract returns the parts of the range outside of the excluded networks
+func (e *exclusions) subtract(r addrRange) []addrRange {
+	var parts []addrRange
+	start := r.first
+	for _, network := range e.networks {
+		if network.first.BitLen() != start.BitLen() || network.last.Less(start) {
+			continue
+		}
+		if r.last.Less(network.first) {
+			break
+		}
+		if start.Less(network.first) {
+			parts = append(parts, addrRange{first: start, last: network.first.Prev()})
+		}
+		if !network.last.Less(r.last) {
+			return parts
+		}
+		start = network.last.Next()
+	}
+	return append(parts, addrRange{first: start, last: r.last})
+}
@@ -0,0 +1,56 @@
+package runner
+
+import (
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseExclusions(t *testing.T) {
+	excluded, err := parseExclusions([]string{"# scope", "20.0.1.0/24", "20.0.3.5", "AS64500-AS64510", "13335", "amazon*", "org:HE", "cn", "country:de", ""})
+	require.Nil(t, err)
+	require.Len(t, excluded.networks, 2)
+	require.Equal(t, [][2]uint32{{64500, 64510}, {13335, 13335}}, excluded.asns)
+	require.Len(t, excluded.orgs, 2)
+	require.Contains(t, excluded.countries, "CN")
+	require.Contains(t, excluded.countries, "DE")
+
+	_, err = parseExclusions([]string{"country:germany"})
+	require.NotNil(t, err)
+	_, err = parseExclusions([]string{"domain:example.com"})
+	require.NotNil(t, err)
+}
+
+func TestApplyExclusions(t *testing.T) {
+	excluded, err := parseExclusions([]string{"20.0.1.0/24", "20.0.3.5", "20.0.9.0-20.0.12.255", "2a00::/33", "AS13335", "AS64500-AS64510", "amazon*", "CN"})
+	require.Nil(t, err)
+
+	responses := []*asnmap.Response{
+		{FirstIp: "20.0.0.0", LastIp: "20.0.3.255", ASN: 1, Org: "first"},
+		{FirstIp: "20.0.8.0", LastIp: "20.0.11.255", ASN: 2, Org: "second"},
+		{FirstIp: "20.0.16.0", LastIp: "20.0.16.255", ASN: 3, Org: "third"},
+		{FirstIp: "2a00::", LastIp: "2a00:ffff:ffff:ffff:ffff:ffff:ffff:ffff", ASN: 4, Org: "fourth"},
+		{FirstIp: "104.16.0.0", LastIp: "104.31.255.255", ASN: 13335, Org: "CLOUDFLARENET"},
+		{FirstIp: "3.0.0.0", LastIp: "3.255.255.255", ASN: 16509, Org: "AMAZON-02"},
+		{FirstIp: "1.0.1.0", LastIp: "1.0.3.255", ASN: 4134, Org: "CHINANET", Country: "cn"},
+		{Input: "10.0.0.1", Annotation: "private use (RFC 1918)"},
+		// responses without a range are dropped by their asn too
+		{Input: "64501", ASN: 64501, Annotation: "documentation (RFC 5398)"},
+	}
+	var ranges []string
+	for _, response := range excluded.apply(responses) {
+		ranges = append(ranges, response.FirstIp+"-"+response.LastIp)
+	}
+	require.Equal(t, []string{
+		"20.0.0.0-20.0.0.255",
+		"20.0.2.0-20.0.3.4",
+		"20.0.3.6-20.0.3.255",
+		"20.0.8.0-20.0.8.255",
+		"20.0.16.0-20.0.16.255",
+		"2a00:0:8000::-2a00:ffff:ffff:ffff:ffff:ffff:ffff:ffff",
+		"-",
+	}, ranges)
+	// unchanged responses are kept as is
+	require.Same(t, responses[2], excluded.apply(responses[2:3])[0])
+}
@@ -0,0 +1,109 @@
+package runner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// itemMeta is stored alongside every input item
+type itemMeta struct {
+	// Source describes where the item type was declared (e.g. "-org option")
+	Source string `json:"source,omitempty"`
+	// Records is the number of original jsonl records the item was extracted from,
+	// the records are stored under their own keys
+	Records int `json:"records,omitempty"`
+}
+
+func decodeItemMeta(value []byte) itemMeta {
+	var meta itemMeta
+	if len(value) > 0 {
+		_ = json.Unmarshal(value, &meta)
+	}
+	return meta
+}
+
+// recordKey is the input store key of the n-th record of an item. Input store keys
+// used internally start with a NUL byte, which never starts an item key.
+func recordKey(key string, n int) string {
+	return "\x00record\x00" + strconv.Itoa(n) + "\x00" + key
+}
+
+// recordHashKey marks a record as stored for an item
+func recordHashKey(key string, record string) string {
+	sum := sha256.Sum256([]byte(record))
+	return "\x00recordhash\x00" + hex.EncodeToString(sum[:]) + "\x00" + key
+}
+
+// addRecord stores a jsonl record of an item unless it was already stored
+func (r *Runner) addRecord(key string, meta *itemMeta, record string) {
+	hashKey := recordHashKey(key, record)
+	if _, ok := r.hm.Get(hashKey); ok {
+		return
+	}
+	if err := r.hm.Set(recordKey(key, meta.Records), []byte(record)); err != nil {
+		return
+	}
+	_ = r.hm.Set(hashKey, nil)
+	meta.Records++
+}
+
+// itemRecords returns the jsonl records of an item in the order they were read
+func (r *Runner) itemRecords(key string, meta itemMeta) []string {
+	if meta.Records == 0 {
+		return nil
+	}
+	records := make([]string, 0, meta.Records)
+	for n := 0; n < meta.Records; n++ {
+		if record, ok := r.hm.Get(recordKey(key, n)); ok {
+			records = append(records, string(record))
+		}
+	}
+	return records
+}
+
+// extractFields returns the values selected from a jsonl record. Selectors are dot separated
+// paths where a "[]" suffix iterates over an array, e.g. "host", "a[]" or "answers[].ip".
+func extractFields(record map[string]interface{}, selector string) []string {
+	values := []interface{}{record}
+	for _, part := range strings.Split(selector, ".") {
+		key, isArray := strings.CutSuffix(part, "[]")
+		var next []interface{}
+		for _, value := range values {
+			object, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			field, ok := object[key]
+			if !ok {
+				continue
+			}
+			if items, ok := field.([]interface{}); ok && isArray {
+				next = append(next, items...)
+			} else {
+				next = append(next, field)
+			}
+		}
+		values = next
+	}
+
+	var fields []string
+	for _, value := range values {
+		switch v := value.(type) {
+		case string:
+			fields = append(fields, v)
+		case float64:
+			fields = append(fields, strconv.FormatFloat(v, 'f', -1, 64))
+		case []interface{}:
+			// arrays selected without "[]" are flattened as well
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					fields = append(fields, s)
+				}
+			}
+		}
+	}
+	return fields
+}
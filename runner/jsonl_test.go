@@ -0,0 +1,148 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractFields(t *testing.T) {
+	var record map[string]interface{}
+	require.Nil(t, json.Unmarshal([]byte(`{"host":"example.com","ip":"1.1.1.1","port":443,"a":["1.2.3.4","5.6.7.8"],"answers":[{"ip":"9.9.9.9"},{"ip":"8.8.8.8"}]}`), &record))
+
+	tt := []struct {
+		selector string
+		expected []string
+	}{
+		{"host", []string{"example.com"}},
+		{"ip", []string{"1.1.1.1"}},
+		{"port", []string{"443"}},
+		{"a[]", []string{"1.2.3.4", "5.6.7.8"}},
+		{"a", []string{"1.2.3.4", "5.6.7.8"}},
+		{"answers[].ip", []string{"9.9.9.9", "8.8.8.8"}},
+		{"missing", nil},
+		{"host.name", nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.selector, func(t *testing.T) {
+			require.Equal(t, tc.expected, extractFields(record, tc.selector))
+		})
+	}
+}
+
+func TestProcessForJSONLInput(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=1.2.3.4": {{FirstIp: "1.2.3.0", LastIp: "1.2.3.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+		"ip=5.6.7.8": {{FirstIp: "5.6.0.0", LastIp: "5.6.255.255", ASN: 64500, Country: "DE", Org: "example"}},
+	})
+
+	var buf bytes.Buffer
+	options := &Options{
+		FileInput: []string{
+			`{"host":"a.example","a":["1.2.3.4"]}`,
+			`{"host":"b.example","a":["1.2.3.4","5.6.7.8"]}`,
+			`not json`,
+			// repeated records are carried through once
+			`{"host":"a.example","a":["1.2.3.4"]}`,
+		},
+		InputFormat:   inputFormatJSONL,
+		InputField:    []string{"a[]"},
+		DisplayInJSON: true,
+		Output:        &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.process(context.Background()))
+	require.Nil(t, r.Close())
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var result asnmap.Result
+		require.Nil(t, json.Unmarshal([]byte(line), &result))
+		lines = append(lines, result.Input+" "+string(result.Record))
+	}
+	sort.Strings(lines)
+	require.Equal(t, []string{
+		`1.2.3.4 {"host":"a.example","a":["1.2.3.4"]}`,
+		`1.2.3.4 {"host":"b.example","a":["1.2.3.4","5.6.7.8"]}`,
+		`5.6.7.8 {"host":"b.example","a":["1.2.3.4","5.6.7.8"]}`,
+	}, lines)
+}
+
+func TestProcessForJSONLInputDedupe(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=1.2.3.4": {{FirstIp: "1.2.3.0", LastIp: "1.2.3.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+		"ip=1.2.3.5": {{FirstIp: "1.2.3.0", LastIp: "1.2.3.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+
+	var buf bytes.Buffer
+	options := &Options{
+		FileInput: []string{
+			`{"host":"a.example","a":["1.2.3.4"]}`,
+			`{"host":"b.example","a":["1.2.3.4"]}`,
+			`{"host":"c.example","a":["1.2.3.5"]}`,
+		},
+		InputFormat:   inputFormatJSONL,
+		InputField:    []string{"a[]"},
+		Dedupe:        true,
+		DisplayInJSON: true,
+		Output:        &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.process(context.Background()))
+	require.Nil(t, r.Close())
+
+	// every record of the first item keeps the range, the range is not repeated for the next item
+	var records []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var result asnmap.Result
+		require.Nil(t, json.Unmarshal([]byte(line), &result))
+		require.Equal(t, "1.2.3.4", result.Input)
+		records = append(records, string(result.Record))
+	}
+	sort.Strings(records)
+	require.Equal(t, []string{
+		`{"host":"a.example","a":["1.2.3.4"]}`,
+		`{"host":"b.example","a":["1.2.3.4"]}`,
+	}, records)
+}
+
+func TestPrepareInputLongStdinLine(t *testing.T) {
+	stdin, w, err := os.Pipe()
+	require.Nil(t, err)
+	defer stdin.Close()
+	oldStdin := os.Stdin
+	os.Stdin = stdin
+	t.Cleanup(func() { os.Stdin = oldStdin })
+
+	// a record larger than the default scanner buffer followed by a plain input
+	go func() {
+		fmt.Fprintf(w, `{"a":["1.2.3.4"],"pad":"%s"}`+"\n", strings.Repeat("x", 100*1024))
+		fmt.Fprintln(w, `{"a":["5.6.7.8"]}`)
+		w.Close()
+	}()
+
+	r, err := New(&Options{InputFormat: inputFormatJSONL, InputField: []string{"a[]"}, Output: io.Discard})
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	defer r.Close()
+
+	var inputs []string
+	for n := 0; n < r.inputs; n++ {
+		_, value, _ := strings.Cut(r.inputKey(n), ":")
+		inputs = append(inputs, value)
+	}
+	require.Equal(t, []string{"1.2.3.4", "5.6.7.8"}, inputs)
+}
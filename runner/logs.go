@@ -0,0 +1,186 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// runs of digits and dots are matched whole so that longer dotted numbers (e.g. versions) are rejected
+	ipv4Regex = regexp.MustCompile(`[0-9][0-9.]*[0-9]`)
+	ipv6Regex = regexp.MustCompile(`[0-9A-Fa-f]{0,4}(?::(?:(?:[0-9]{1,3}\.){3}[0-9]{1,3}|[0-9A-Fa-f]{0,4})){2,7}`)
+)
+
+// extractIPs returns the unique valid ipv4 and ipv6 addresses found in a line of text,
+// ipv4 mapped ipv6 addresses are returned as ipv4
+func extractIPs(line string) []netip.Addr {
+	var addrs []netip.Addr
+	add := func(addr netip.Addr) {
+		for _, existing := range addrs {
+			if existing == addr {
+				return
+			}
+		}
+		addrs = append(addrs, addr)
+	}
+	for _, match := range ipv4Regex.FindAllString(line, -1) {
+		if addr, err := netip.ParseAddr(match); err == nil && addr.Is4() {
+			add(addr)
+		}
+	}
+	if strings.Contains(line, ":") {
+		for _, match := range ipv6Regex.FindAllString(line, -1) {
+			if addr, err := netip.ParseAddr(match); err == nil && addr.Is6() {
+				add(addr.Unmap())
+			}
+		}
+	}
+	return addrs
+}
+
+// logGroup is the log hits attributed to an asn
+type logGroup struct {
+	ASN       string `json:"as_number"`
+	ASName    string `json:"as_name"`
+	ASCountry string `json:"as_country"`
+	Hits      int64  `json:"hits"`
+	IPs       int    `json:"ips"`
+}
+
+// processLogs extracts the ips of text logs and ranks the owning asns by the
+// number of hits and unique ips
+func (r *Runner) processLogs(ctx context.Context) error {
+	hits := map[netip.Addr]int64{}
+	for _, file := range r.options.Logs {
+		if err := countLogHits(file, hits); err != nil {
+			return fmt.Errorf("could not read '%s': %w", file, err)
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, len(hits))
+	for addr := range hits {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+
+	r.stats.reset()
+	var cache responseCache
+	groups := map[int]*logGroup{}
+	for _, addr := range addrs {
+		// an interrupted run reports the ips looked up so far
+		if ctx.Err() != nil {
+			break
+		}
+		if !isRoutable(addr) {
+			continue
+		}
+		response, err := r.lookupReportTarget(addr.String(), &cache)
+		if err != nil {
+			return err
+		}
+		if response == nil {
+			continue
+		}
+		group, ok := groups[response.ASN]
+		if !ok {
+			group = &logGroup{
+				ASN:       fmt.Sprintf("AS%d", response.ASN),
+				ASName:    response.Org,
+				ASCountry: response.Country,
+			}
+			groups[response.ASN] = group
+		}
+		group.Hits += hits[addr]
+		group.IPs++
+	}
+
+	sorted := make([]*logGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Hits != sorted[j].Hits {
+			return sorted[i].Hits > sorted[j].Hits
+		}
+		if sorted[i].IPs != sorted[j].IPs {
+			return sorted[i].IPs > sorted[j].IPs
+		}
+		return sorted[i].ASN < sorted[j].ASN
+	})
+	if err := r.writeLogGroups(sorted); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return r.failedInputsError()
+}
+
+// countLogHits counts the ips found in every line of a log file or stdin ("-")
+func countLogHits(file string, hits map[netip.Addr]int64) error {
+	var input io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		input = f
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		for _, addr := range extractIPs(scanner.Text()) {
+			hits[addr]++
+		}
+	}
+	return scanner.Err()
+}
+
+func (r *Runner) writeLogGroups(groups []*logGroup) error {
+	if r.options.Output == nil {
+		return nil
+	}
+	switch {
+	case r.options.DisplayInJSON:
+		for _, group := range groups {
+			record, err := json.Marshal(group)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(r.options.Output, "%s\n", record); err != nil {
+				return err
+			}
+		}
+	case r.options.DisplayInCSV:
+		w := csv.NewWriter(r.options.Output)
+		w.Comma = '|'
+		if err := w.Write([]string{"as_number", "as_name", "as_country", "hits", "ips"}); err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if err := w.Write([]string{group.ASN, group.ASName, group.ASCountry, strconv.FormatInt(group.Hits, 10), strconv.Itoa(group.IPs)}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		for _, group := range groups {
+			if _, err := fmt.Fprintf(r.options.Output, "%s [%s] [%s] hits=%d ips=%d\n", group.ASN, group.ASName, group.ASCountry, group.Hits, group.IPs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractIPs(t *testing.T) {
+	tt := []struct {
+		name     string
+		line     string
+		expected []string
+	}{
+		{"access log", `104.16.99.52 - - [10/Oct/2023:13:55:36 +0000] "GET / HTTP/1.1" 200 2326 "-" "curl/8.0"`, []string{"104.16.99.52"}},
+		{"firewall log", `Oct 10 13:55:36 fw kernel: DROP IN=eth0 SRC=8.8.8.8 DST=10.0.0.1 PROTO=TCP SPT=443 DPT=51234`, []string{"8.8.8.8", "10.0.0.1"}},
+		{"zeek conn.log", "1696946136.123\tCk3b1\t2001:db8::1\t51234\t2606:4700::6810:6334\t443\ttcp", []string{"2001:db8::1", "2606:4700::6810:6334"}},
+		{"bracketed ipv6 with port", `connect to [2606:4700::1]:443 from ::ffff:1.2.3.4`, []string{"1.2.3.4", "2606:4700::1"}},
+		{"space separated", `1.1.1.1 2.2.2.2,3.3.3.3`, []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}},
+		{"invalid octets and versions", `version 1.2.3.4.5 and 300.1.1.1 at 13:55:36`, nil},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var actual []string
+			for _, addr := range extractIPs(tc.line) {
+				actual = append(actual, addr.String())
+			}
+			require.Equal(t, tc.expected, actual)
+		})
+	}
+}
+
+func TestProcessLogs(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=8.8.4.4":      {{FirstIp: "8.8.4.0", LastIp: "8.8.8.255", ASN: 15169, Country: "US", Org: "google"}},
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	require.Nil(t, os.WriteFile(file, []byte(strings.Join([]string{
+		`104.16.99.52 - - [10/Oct/2023:13:55:36 +0000] "GET / HTTP/1.1" 200 2326`,
+		`104.16.99.52 - - [10/Oct/2023:13:55:37 +0000] "GET /login HTTP/1.1" 200 512`,
+		`104.16.99.52 - - [10/Oct/2023:13:55:38 +0000] "GET /admin HTTP/1.1" 403 0`,
+		`8.8.4.4 - - [10/Oct/2023:13:55:39 +0000] "GET / HTTP/1.1" 200 2326`,
+		`8.8.8.8 - - [10/Oct/2023:13:55:40 +0000] "GET / HTTP/1.1" 200 2326`,
+		`192.168.1.10 - - [10/Oct/2023:13:55:41 +0000] "GET / HTTP/1.1" 200 2326`,
+	}, "\n")), 0600))
+
+	var buf bytes.Buffer
+	options := &Options{Logs: []string{file}, Output: &buf}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.processLogs(context.Background()))
+	require.Nil(t, r.Close())
+
+	require.Equal(t, "AS13335 [cloudflarenet] [US] hits=3 ips=1\n"+
+		"AS15169 [google] [US] hits=2 ips=2\n", buf.String())
+	require.True(t, isRoutable(netip.MustParseAddr("8.8.8.8")))
+}
+
+func TestProcessLogsLookupErrors(t *testing.T) {
+	server := newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+	handler := server.Config.Handler
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ip") == "8.8.8.8" {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+
+	file := filepath.Join(t.TempDir(), "access.log")
+	require.Nil(t, os.WriteFile(file, []byte("104.16.99.52 GET /\n8.8.8.8 GET /\n"), 0600))
+
+	// failed lookups fail the run instead of being reported as unknown owners
+	var buf bytes.Buffer
+	r, err := New(&Options{Logs: []string{file}, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processLogs(context.Background()), ErrFailedInputs)
+	require.Equal(t, "AS13335 [cloudflarenet] [US] hits=1 ips=1\n", buf.String())
+	require.Nil(t, r.Close())
+
+	status.Store(http.StatusUnauthorized)
+	buf.Reset()
+	r, err = New(&Options{Logs: []string{file}, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processLogs(context.Background()), asnmap.ErrUnAuthorized)
+	require.Nil(t, r.Close())
+}
@@ -2,9 +2,11 @@ package runner
 
 import (
 	"errors"
+	"flag"
+	"fmt"
 	"io"
 	"os"
-	"strings"
+	"time"
 
 	asnmap "github.com/projectdiscovery/asnmap/libs"
 	"github.com/projectdiscovery/goflags"
@@ -20,6 +22,13 @@ type OnResultCallback func([]*asnmap.Response)
 
 var cfgFile string
 
+const (
+	inputFormatText    = "text"
+	inputFormatJSONL   = "jsonl"
+	inputFormatNmap    = "nmap"
+	inputFormatMasscan = "masscan"
+)
+
 type Options struct {
 	FileInput          goflags.StringSlice
 	Resolvers          goflags.StringSlice
@@ -28,17 +37,50 @@ type Options struct {
 	Ip                 goflags.StringSlice
 	Org                goflags.StringSlice
 	Proxy              goflags.StringSlice
+	PinnedSPKI         goflags.StringSlice
+	ProxyCheckInterval time.Duration
+	CAFile             string
+	ClientCert         string
+	ClientKey          string
+	Insecure           bool
 	OutputFile         string
-	PdcpAuth           string
-	Output             io.Writer
-	DisplayInJSON      bool
-	DisplayInCSV       bool
-	Silent             bool
-	Verbose            bool
-	Version            bool
-	DisplayIPv6        bool
+	InputType          string
+	InputFormat        string
+	InputField         goflags.StringSlice
+	Pcap               goflags.StringSlice
+	Logs               goflags.StringSlice
+	Exclude            goflags.StringSlice
+	Concurrency        int
+	Sort               string
+	Resume             string
+	FailedOutput       string
+	Stats              bool
+	StatsInterval      time.Duration
+	StatsJSON          string
+	// Dedupe writes every range once per run
+	Dedupe bool
+	// Aggregate merges the ranges of a run into the smallest covering set of cidrs
+	Aggregate bool
+	// ContinueOnError keeps processing the remaining inputs when a lookup fails
+	ContinueOnError bool
+	PdcpAuth        string
+	Output          io.Writer
+	DisplayInJSON   bool
+	DisplayInCSV    bool
+	// CSVInputType adds the input_type column to csv output
+	CSVInputType bool
+	Explain      bool
+	Enrich       bool
+	Silent       bool
+	Verbose      bool
+	Version      bool
+	DisplayIPv6  bool
+	// OnResult is called with the results of every input item. Calls are never
+	// concurrent and follow the input order, or the Sort order one response at a time.
 	OnResult           OnResultCallback
 	DisableUpdateCheck bool
+	// Metrics optionally collects lookup statistics (library usage only)
+	Metrics *asnmap.Metrics
 }
 
 // configureOutput configures the output on the screen
@@ -56,32 +98,76 @@ func (options *Options) validateOptions() error {
 		return errors.New("verbose and silent can't be used together")
 	}
 
-	if options.Asn == nil && options.Ip == nil && options.Org == nil && options.Domain == nil && !fileutil.HasStdin() && cfgFile == "" && options.FileInput == nil {
+	if options.Asn == nil && options.Ip == nil && options.Org == nil && options.Domain == nil && options.Pcap == nil && options.Logs == nil && !fileutil.HasStdin() && cfgFile == "" && options.FileInput == nil {
 		return errors.New("no input defined")
 	}
 
-	if options.Asn != nil && (options.Ip != nil || options.Org != nil || options.Domain != nil) {
-		return errors.New("asn and other options like ip, org and domain can't be used together as input to get data")
-	} else if options.Ip != nil && (options.Asn != nil || options.Org != nil || options.Domain != nil) {
-		return errors.New("ip and other options like asn, org and domain can't be used together as input to get data")
-	} else if options.Org != nil && (options.Asn != nil || options.Ip != nil || options.Domain != nil) {
-		return errors.New("org and other options like asn, ip and domain can't be used together as input to get data")
-	} else if options.Domain != nil && (options.Asn != nil || options.Ip != nil || options.Org != nil) {
-		return errors.New("domain and other options like asn, ip and org can't be used together as input to get data")
+	if options.Enrich && (options.Explain || options.DisplayInCSV) {
+		return errors.New("enrich mode writes jsonl records and can't be used with explain or csv")
 	}
 
-	if options.DisplayInJSON && options.DisplayInCSV {
-		return errors.New("can either display in json or csv")
+	if options.Stats && options.StatsInterval <= 0 {
+		return errors.New("stats interval must be positive")
 	}
 
-	// validate asn input
-	if options.Asn != nil {
-		for _, asn := range options.Asn {
-			if !strings.HasPrefix(strings.ToUpper(asn), "AS") {
-				return errors.New("invalid ASN given. it should start with prefix 'AS', example : AS14421")
-			}
+	// report modes write their own output instead of the looked up ranges
+	reportMode := options.Enrich || options.Explain || options.Pcap != nil || options.Logs != nil ||
+		options.InputFormat == inputFormatNmap || options.InputFormat == inputFormatMasscan
+
+	if options.Resume != "" && reportMode {
+		return errors.New("resume is only supported for lookups")
+	}
+
+	if (options.Stats || options.StatsJSON != "") && reportMode {
+		return errors.New("stats are only supported for lookups")
+	}
+
+	if (options.Dedupe || options.Aggregate) && reportMode {
+		return errors.New("dedupe and aggregate are only supported for lookups")
+	}
+
+	if len(options.Exclude) > 0 && reportMode {
+		return errors.New("exclude is only supported for lookups")
+	}
+
+	if options.Aggregate && (options.DisplayInJSON || options.DisplayInCSV) {
+		return errors.New("aggregate writes plain cidrs and can't be used with json or csv")
+	}
+
+	switch options.Sort {
+	case "", sortByInput, sortByASN, sortByIP, sortByOrg:
+	default:
+		return fmt.Errorf("invalid sort mode '%s', supported modes are input, asn, ip and org", options.Sort)
+	}
+
+	switch options.InputFormat {
+	case "", inputFormatText:
+	case inputFormatJSONL:
+		if len(options.InputField) == 0 {
+			return errors.New("jsonl input format requires at least one input field, example: -input-field host")
+		}
+	case inputFormatNmap, inputFormatMasscan:
+		if options.Explain {
+			return errors.New("explain can't be used with nmap or masscan input")
 		}
+	default:
+		return fmt.Errorf("invalid input format '%s', supported formats are text, jsonl, nmap and masscan", options.InputFormat)
 	}
+
+	if options.InputType != "" {
+		if _, err := asnmap.ParseInputType(options.InputType); err != nil {
+			return err
+		}
+	}
+
+	if (options.ClientCert == "") != (options.ClientKey == "") {
+		return errors.New("client-cert and client-key must be used together")
+	}
+
+	if options.DisplayInJSON && options.DisplayInCSV {
+		return errors.New("can either display in json or csv")
+	}
+
 	return nil
 }
 
@@ -89,15 +175,31 @@ func (options *Options) validateOptions() error {
 func ParseOptions() *Options {
 	options := &Options{}
 	flagSet := goflags.NewFlagSet()
-	flagSet.SetDescription(`Go CLI and Library for quickly mapping organization network ranges using ASN information.`)
+	flagSet.SetDescription(`Go CLI and Library for quickly mapping organization network ranges using ASN information.
+
+Run 'asnmap enrich' to add asn, as_name, as_country and as_range keys to jsonl records read from stdin.`)
+
+	// the enrich mode is selected with a leading subcommand, the flags follow it. A bare
+	// subcommand leaves no args and the parser stops at it as a positional argument.
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "enrich" {
+		options.Enrich = true
+		args = args[1:]
+	}
 
 	// Input
 	flagSet.CreateGroup("input", "Input",
-		flagSet.StringSliceVarP(&options.Asn, "asn", "a", nil, "target asn to lookup, example: -a AS5650", goflags.FileNormalizedStringSliceOptions),
-		flagSet.StringSliceVarP(&options.Ip, "ip", "i", nil, "target ip to lookup, example: -i 100.19.12.21, -i 2a10:ad40:: ", goflags.FileNormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Asn, "asn", "a", nil, "target asn or asn range to lookup, example: -a AS5650, -a AS1.10, -a AS64500-AS64510", goflags.FileNormalizedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Ip, "ip", "i", nil, "target ip, cidr or ip range to lookup, example: -i 100.19.12.21, -i 2a10:ad40::, -i 1.2.3.0/22, -i 1.2.3.4-1.2.5.9", goflags.FileNormalizedStringSliceOptions),
 		flagSet.StringSliceVarP(&options.Domain, "domain", "d", nil, "target domain to lookup, example: -d google.com, -d facebook.com", goflags.FileNormalizedStringSliceOptions),
 		flagSet.StringSliceVar(&options.Org, "org", nil, "target organization to lookup, example: -org GOOGLE", goflags.StringSliceOptions),
 		flagSet.StringSliceVarP(&options.FileInput, "file", "f", nil, "targets to lookup from file", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVarP(&options.Exclude, "exclude", "ex", nil, "cidrs, ip ranges, asns, org patterns (* wildcard) or country codes to leave out of the output, example: -ex 1.2.3.0/24, -ex AS13335, -ex 'amazon*', -ex CN", goflags.FileStringSliceOptions),
+		flagSet.StringVarP(&options.InputFormat, "input-format", "if", inputFormatText, "format of stdin and file targets (text, jsonl, nmap, masscan)"),
+		flagSet.StringSliceVarP(&options.InputField, "input-field", "ifl", nil, "jsonl fields to extract targets from (enrich default: ip,host,a[]), example: -ifl host -ifl a[]", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVar(&options.Pcap, "pcap", nil, "pcap or pcapng capture files to attribute traffic from", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringSliceVar(&options.Logs, "logs", nil, "text log files to extract ips from and rank asns by hits (- for stdin)", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.StringVarP(&options.InputType, "input-type", "it", "", "type of stdin and file targets, bypassing detection (asn, ip, cidr, ip_range, asn_range, domain, url, email, org)"),
 	)
 
 	// Configs
@@ -105,7 +207,14 @@ func ParseOptions() *Options {
 		flagSet.DynamicVar(&options.PdcpAuth, "auth", "true", "configure ProjectDiscovery Cloud Platform (PDCP) api key"),
 		flagSet.StringVar(&cfgFile, "config", "", "path to the asnmap configuration file"),
 		flagSet.StringSliceVarP(&options.Resolvers, "resolvers", "r", nil, "list of resolvers to use", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.IntVar(&options.Concurrency, "concurrency", 1, "number of concurrent lookups"),
 		flagSet.StringSliceVarP(&options.Proxy, "proxy", "p", nil, "list of proxy to use (comma separated or file input)", goflags.FileCommaSeparatedStringSliceOptions),
+		flagSet.DurationVar(&options.ProxyCheckInterval, "proxy-check-interval", 30*time.Second, "interval to re-check the health of proxies"),
+		flagSet.StringVar(&options.CAFile, "ca-file", "", "custom ca bundle (pem) to verify the asnmap server"),
+		flagSet.StringVar(&options.ClientCert, "client-cert", "", "client certificate (pem) for mtls authentication"),
+		flagSet.StringVar(&options.ClientKey, "client-key", "", "client key (pem) for mtls authentication"),
+		flagSet.StringSliceVar(&options.PinnedSPKI, "pin-spki", nil, "base64 sha256 spki hash(es) the server certificate must match", goflags.CommaSeparatedStringSliceOptions),
+		flagSet.BoolVar(&options.Insecure, "insecure", false, "disable tls certificate verification of the asnmap server"),
 	)
 
 	// Update
@@ -117,18 +226,34 @@ func ParseOptions() *Options {
 	// Output
 	flagSet.CreateGroup("output", "Output",
 		flagSet.StringVarP(&options.OutputFile, "output", "o", "", "file to write output to"),
+		flagSet.StringVarP(&options.FailedOutput, "failed-output", "fo", "", "file to write failed inputs to, usable as file input to retry them"),
 		flagSet.BoolVarP(&options.DisplayInJSON, "json", "j", false, "display json format output"),
 		flagSet.BoolVarP(&options.DisplayInCSV, "csv", "c", false, "display csv format output"),
+		flagSet.BoolVarP(&options.CSVInputType, "csv-input-type", "cit", false, "add the input_type column to csv output"),
+		flagSet.BoolVarP(&options.ContinueOnError, "continue-on-error", "coe", false, "continue with the remaining inputs when a lookup fails (default for stdin and file input)"),
+		flagSet.StringVar(&options.Resume, "resume", "", "resume file recording completed inputs, an interrupted run continues from it and appends to the output"),
+		flagSet.StringVar(&options.Sort, "sort", sortByInput, "order of the output (input, asn, ip, org)"),
+		flagSet.BoolVar(&options.Dedupe, "dedupe", false, "write every range only once across all inputs"),
+		flagSet.BoolVar(&options.Aggregate, "aggregate", false, "merge adjacent and overlapping cidrs of all inputs into the smallest covering set"),
+		flagSet.BoolVar(&options.Explain, "explain", false, "display how each input is classified without looking it up"),
+		flagSet.BoolVar(&options.Stats, "stats", false, "display live progress on stderr and an end of run summary"),
+		flagSet.DurationVarP(&options.StatsInterval, "stats-interval", "si", time.Second, "interval to update the live progress"),
+		flagSet.StringVar(&options.StatsJSON, "stats-json", "", "file to write the end of run statistics to (json)"),
 		flagSet.BoolVar(&options.DisplayIPv6, "v6", false, "display ipv6 cidr ranges in cli output"),
 		flagSet.BoolVarP(&options.Verbose, "verbose", "v", false, "display verbose output"),
 		flagSet.BoolVar(&options.Silent, "silent", false, "display silent output"),
 		flagSet.BoolVar(&options.Version, "version", false, "show version of the project"),
 	)
 
-	if err := flagSet.Parse(); err != nil {
+	if err := flagSet.Parse(args...); err != nil {
 		gologger.Fatal().Msgf("%s\n", err)
 	}
 
+	// batch input continues on error unless disabled with -continue-on-error=false
+	if !isFlagSet(flagSet, "continue-on-error", "coe") {
+		options.ContinueOnError = fileutil.HasStdin() || len(options.FileInput) > 0
+	}
+
 	// api key hierarchy: cli flag > env var > .pdcp/credential file
 	if options.PdcpAuth == "true" {
 		AuthWithPDCP()
@@ -180,3 +305,16 @@ func ParseOptions() *Options {
 
 	return options
 }
+
+// isFlagSet reports whether any of the flag names was given on the command line
+func isFlagSet(flagSet *goflags.FlagSet, names ...string) bool {
+	set := false
+	flagSet.CommandLine.Visit(func(f *flag.Flag) {
+		for _, name := range names {
+			if f.Name == name {
+				set = true
+			}
+		}
+	})
+	return set
+}
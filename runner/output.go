@@ -10,11 +10,21 @@ import (
 	"strings"
 
 	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/projectdiscovery/mapcidr"
 	iputil "github.com/projectdiscovery/utils/ip"
 )
 
 var csvHeaders = [][]string{{"timestamp", "input", "as_number", "as_name", "as_country", "as_range"}}
 
+// csvHeader returns the csv header row, with the input_type column when enabled
+func (r *Runner) csvHeader() []string {
+	header := append([]string{}, csvHeaders[0]...)
+	if r.options.CSVInputType {
+		header = append(header, "input_type")
+	}
+	return header
+}
+
 func (r *Runner) writeToCsv(records [][]string) error {
 	w := csv.NewWriter(r.options.Output)
 	w.Comma = '|'
@@ -68,6 +78,33 @@ func (r *Runner) filterIPv6(ipsnet []*net.IPNet) []*net.IPNet {
 	return filteredIpsNet
 }
 
+// writeResults writes the responses of an item. Items extracted from jsonl records are
+// written once per original record in json output, so that every record is carried through.
+// The responses are deduplicated before, so that the records of an item share the same ones.
+func (r *Runner) writeResults(output []*asnmap.Response, records []string) error {
+	if r.options.Dedupe && r.options.Output != nil {
+		output = r.dedupeResponses(output)
+	}
+	if len(records) == 0 {
+		return r.writeOutput(output)
+	}
+	if !r.options.DisplayInJSON {
+		records = records[:1]
+	}
+	for _, record := range records {
+		withRecord := make([]*asnmap.Response, 0, len(output))
+		for _, response := range output {
+			response := *response
+			response.Record = record
+			withRecord = append(withRecord, &response)
+		}
+		if err := r.writeOutput(withRecord); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // writeOutput either to file or to stdout
 func (r *Runner) writeOutput(output []*asnmap.Response) error {
 	if r.options.OnResult != nil {
@@ -92,7 +129,15 @@ func (r *Runner) writeOutput(output []*asnmap.Response) error {
 		}
 		records := [][]string{}
 		for _, result := range results {
-			record := []string{result.Timestamp, result.Input, result.ASN, result.ASN_org, result.AS_country, strings.Join(result.AS_range, ",")}
+			// annotated inputs have no owner, the as_name column explains why
+			asName := result.ASN_org
+			if asName == "" {
+				asName = result.Annotation
+			}
+			record := []string{result.Timestamp, result.Input, result.ASN, asName, result.AS_country, strings.Join(result.AS_range, ",")}
+			if r.options.CSVInputType {
+				record = append(record, result.InputType)
+			}
 			records = append(records, record)
 		}
 		return r.writeToCsv(records)
@@ -102,7 +147,17 @@ func (r *Runner) writeOutput(output []*asnmap.Response) error {
 			return err
 		}
 		result := r.filterIPv6(cidrs)
+		if r.options.Aggregate {
+			r.aggregated = append(r.aggregated, result...)
+			return nil
+		}
 		for _, cidr := range result {
+			if r.options.Dedupe {
+				if _, ok := r.written[cidr.String()]; ok {
+					continue
+				}
+				r.written[cidr.String()] = struct{}{}
+			}
 			_, err := fmt.Fprintf(r.options.Output, "%v\n", cidr)
 			if err != nil {
 				return err
@@ -111,3 +166,78 @@ func (r *Runner) writeOutput(output []*asnmap.Response) error {
 		return nil
 	}
 }
+
+// dedupeResponses drops the responses whose range was already written in json and csv output,
+// responses without a range are kept. Cidr output is deduplicated per cidr instead.
+func (r *Runner) dedupeResponses(output []*asnmap.Response) []*asnmap.Response {
+	if !r.options.DisplayInJSON && !r.options.DisplayInCSV {
+		return output
+	}
+	deduped := make([]*asnmap.Response, 0, len(output))
+	for _, response := range output {
+		if response.FirstIp != "" {
+			key := response.FirstIp + "-" + response.LastIp
+			if _, ok := r.written[key]; ok {
+				continue
+			}
+			r.written[key] = struct{}{}
+		}
+		deduped = append(deduped, response)
+	}
+	return deduped
+}
+
+// writeAggregated writes the cidrs collected during the run merged into the smallest
+// covering set, ipv4 ranges first
+func (r *Runner) writeAggregated() error {
+	if len(r.aggregated) == 0 {
+		return nil
+	}
+	ipv4, ipv6 := mapcidr.CoalesceCIDRs(r.aggregated)
+	r.aggregated = nil
+	for _, cidr := range append(ipv4, ipv6...) {
+		if _, err := fmt.Fprintf(r.options.Output, "%v\n", cidr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inputExplanation is the json representation of an explained input
+type inputExplanation struct {
+	Input     string `json:"input"`
+	InputType string `json:"input_type"`
+	Reason    string `json:"reason"`
+}
+
+// writeExplanation writes how an input was classified
+func (r *Runner) writeExplanation(item string, inputType asnmap.InputType, reason string) error {
+	if r.options.Output == nil {
+		return nil
+	}
+	if r.options.DisplayInJSON {
+		record, err := json.Marshal(inputExplanation{Input: item, InputType: inputType.String(), Reason: reason})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(r.options.Output, "%s\n", record)
+		return err
+	}
+	_, err := fmt.Fprintf(r.options.Output, "%s => %s (%s)\n", item, inputType, reason)
+	return err
+}
+
+// writeFailure writes a failed input to the failures report, preceded by the error as a
+// comment. The report can be used as file input to retry the failed inputs.
+func (r *Runner) writeFailure(item inputItem, err error) error {
+	if r.failedOutput == nil {
+		return nil
+	}
+	reason := strings.Join(strings.Fields(err.Error()), " ")
+	input := item.value
+	if item.inputType != asnmap.Unknown {
+		input = item.inputType.String() + ":" + item.value
+	}
+	_, errWrite := fmt.Fprintf(r.failedOutput, "# %s\n%s\n", reason, input)
+	return errWrite
+}
@@ -0,0 +1,471 @@
+package runner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+)
+
+// capture file magic numbers
+const (
+	pcapMagicMicro = 0xa1b2c3d4
+	pcapMagicNano  = 0xa1b23c4d
+	pcapngSHB      = 0x0a0d0d0a
+	pcapngBOM      = 0x1a2b3c4d
+)
+
+// pcapng block types
+const (
+	pcapngIDB = 0x00000001
+	pcapngOPB = 0x00000002
+	pcapngSPB = 0x00000003
+	pcapngEPB = 0x00000006
+)
+
+// link layer types
+const (
+	linkTypeNull     = 0
+	linkTypeEthernet = 1
+	linkTypeRaw      = 101
+	linkTypeLoop     = 108
+	linkTypeSLL      = 113
+	linkTypeIPv4     = 228
+	linkTypeIPv6     = 229
+	linkTypeSLL2     = 276
+)
+
+// maxCaptureBlock bounds the size of a single packet record
+const maxCaptureBlock = 16 * 1024 * 1024
+
+// packet is the ip layer summary of a captured packet
+type packet struct {
+	Src, Dst         netip.Addr
+	Protocol         uint8
+	SrcPort, DstPort uint16
+	Length           int
+}
+
+// readCapture calls fn for every ip packet of a pcap or pcapng capture
+func readCapture(input io.Reader, fn func(packet)) error {
+	reader := bufio.NewReader(input)
+	magic, err := reader.Peek(4)
+	if err != nil {
+		return fmt.Errorf("could not read capture header: %w", err)
+	}
+	if binary.LittleEndian.Uint32(magic) == pcapngSHB {
+		return readPcapng(reader, fn)
+	}
+	return readPcap(reader, fn)
+}
+
+// readPcap reads the classic libpcap format
+func readPcap(reader io.Reader, fn func(packet)) error {
+	header := make([]byte, 24)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return fmt.Errorf("could not read pcap header: %w", err)
+	}
+	var order binary.ByteOrder
+	switch {
+	case binary.LittleEndian.Uint32(header) == pcapMagicMicro || binary.LittleEndian.Uint32(header) == pcapMagicNano:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header) == pcapMagicMicro || binary.BigEndian.Uint32(header) == pcapMagicNano:
+		order = binary.BigEndian
+	default:
+		return errors.New("not a pcap or pcapng capture")
+	}
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+
+	record := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(reader, record); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("could not read pcap record: %w", err)
+		}
+		capLen, origLen := order.Uint32(record[8:]), order.Uint32(record[12:])
+		if capLen > maxCaptureBlock {
+			return fmt.Errorf("invalid pcap record length %d", capLen)
+		}
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return fmt.Errorf("could not read pcap record: %w", err)
+		}
+		if p, ok := decodePacket(linkType, data); ok {
+			p.Length = int(origLen)
+			fn(p)
+		}
+	}
+}
+
+// readPcapng reads the pcapng format, which may hold several sections and interfaces
+func readPcapng(reader io.Reader, fn func(packet)) error {
+	var (
+		order      binary.ByteOrder = binary.LittleEndian
+		interfaces []uint32
+		header     = make([]byte, 8)
+	)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("could not read pcapng block: %w", err)
+		}
+
+		blockType := order.Uint32(header)
+		if binary.LittleEndian.Uint32(header) == pcapngSHB {
+			// every section starts with its own byte order
+			bom := make([]byte, 4)
+			if _, err := io.ReadFull(reader, bom); err != nil {
+				return fmt.Errorf("could not read pcapng section: %w", err)
+			}
+			switch {
+			case binary.LittleEndian.Uint32(bom) == pcapngBOM:
+				order = binary.LittleEndian
+			case binary.BigEndian.Uint32(bom) == pcapngBOM:
+				order = binary.BigEndian
+			default:
+				return errors.New("invalid pcapng byte order magic")
+			}
+			blockLen := order.Uint32(header[4:])
+			if blockLen < 16 || blockLen > maxCaptureBlock {
+				return fmt.Errorf("invalid pcapng block length %d", blockLen)
+			}
+			if _, err := io.CopyN(io.Discard, reader, int64(blockLen-12)); err != nil {
+				return fmt.Errorf("could not read pcapng section: %w", err)
+			}
+			interfaces = nil
+			continue
+		}
+
+		blockLen := order.Uint32(header[4:])
+		if blockLen < 12 || blockLen > maxCaptureBlock || blockLen%4 != 0 {
+			return fmt.Errorf("invalid pcapng block length %d", blockLen)
+		}
+		body := make([]byte, blockLen-8)
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return fmt.Errorf("could not read pcapng block: %w", err)
+		}
+		body = body[:len(body)-4]
+
+		var (
+			iface   uint32
+			data    []byte
+			origLen uint32
+		)
+		switch blockType {
+		case pcapngIDB:
+			if len(body) >= 2 {
+				interfaces = append(interfaces, uint32(order.Uint16(body)))
+			}
+			continue
+		case pcapngEPB:
+			if len(body) < 20 {
+				continue
+			}
+			iface = order.Uint32(body)
+			capLen := order.Uint32(body[12:])
+			origLen = order.Uint32(body[16:])
+			if int(capLen) > len(body)-20 {
+				continue
+			}
+			data = body[20 : 20+capLen]
+		case pcapngOPB:
+			if len(body) < 20 {
+				continue
+			}
+			iface = uint32(order.Uint16(body))
+			capLen := order.Uint32(body[12:])
+			origLen = order.Uint32(body[16:])
+			if int(capLen) > len(body)-20 {
+				continue
+			}
+			data = body[20 : 20+capLen]
+		case pcapngSPB:
+			if len(body) < 4 {
+				continue
+			}
+			origLen = order.Uint32(body)
+			data = body[4:]
+			if int(origLen) < len(data) {
+				data = data[:origLen]
+			}
+		default:
+			continue
+		}
+		if int(iface) >= len(interfaces) {
+			continue
+		}
+		if p, ok := decodePacket(interfaces[iface], data); ok {
+			p.Length = int(origLen)
+			fn(p)
+		}
+	}
+}
+
+// decodePacket strips the link layer and decodes the ip header
+func decodePacket(linkType uint32, data []byte) (packet, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return packet{}, false
+		}
+		etherType, offset := binary.BigEndian.Uint16(data[12:]), 14
+		// skip 802.1Q and 802.1ad vlan tags
+		for (etherType == 0x8100 || etherType == 0x88a8) && len(data) >= offset+4 {
+			etherType, offset = binary.BigEndian.Uint16(data[offset+2:]), offset+4
+		}
+		if etherType != 0x0800 && etherType != 0x86dd {
+			return packet{}, false
+		}
+		return decodeIP(data[offset:])
+	case linkTypeNull, linkTypeLoop:
+		// the ip version is read from the header instead of the address family
+		if len(data) < 4 {
+			return packet{}, false
+		}
+		return decodeIP(data[4:])
+	case linkTypeSLL:
+		if len(data) < 16 {
+			return packet{}, false
+		}
+		return decodeIP(data[16:])
+	case linkTypeSLL2:
+		if len(data) < 20 {
+			return packet{}, false
+		}
+		return decodeIP(data[20:])
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+		return decodeIP(data)
+	}
+	return packet{}, false
+}
+
+// decodeIP decodes the addresses and tcp/udp ports of an ipv4 or ipv6 packet
+func decodeIP(data []byte) (packet, bool) {
+	var (
+		p       packet
+		payload []byte
+	)
+	if len(data) < 1 {
+		return p, false
+	}
+	switch data[0] >> 4 {
+	case 4:
+		headerLen := int(data[0]&0x0f) * 4
+		if len(data) < 20 || headerLen < 20 {
+			return p, false
+		}
+		p.Src = netip.AddrFrom4([4]byte(data[12:16]))
+		p.Dst = netip.AddrFrom4([4]byte(data[16:20]))
+		p.Protocol = data[9]
+		// only the first fragment carries the transport header
+		if binary.BigEndian.Uint16(data[6:])&0x1fff == 0 && len(data) > headerLen {
+			payload = data[headerLen:]
+		}
+	case 6:
+		if len(data) < 40 {
+			return p, false
+		}
+		p.Src = netip.AddrFrom16([16]byte(data[8:24]))
+		p.Dst = netip.AddrFrom16([16]byte(data[24:40]))
+		p.Protocol = data[6]
+		payload = data[40:]
+	default:
+		return p, false
+	}
+	if (p.Protocol == 6 || p.Protocol == 17) && len(payload) >= 4 {
+		p.SrcPort = binary.BigEndian.Uint16(payload)
+		p.DstPort = binary.BigEndian.Uint16(payload[2:])
+	}
+	return p, true
+}
+
+// flowKey identifies a flow regardless of its direction
+type flowKey struct {
+	A, B     netip.AddrPort
+	Protocol uint8
+}
+
+func newFlowKey(p packet) flowKey {
+	a, b := netip.AddrPortFrom(p.Src, p.SrcPort), netip.AddrPortFrom(p.Dst, p.DstPort)
+	if b.Addr().Less(a.Addr()) || (b.Addr() == a.Addr() && b.Port() < a.Port()) {
+		a, b = b, a
+	}
+	return flowKey{A: a, B: b, Protocol: p.Protocol}
+}
+
+// trafficStats counts the packets and bytes of a flow
+type trafficStats struct {
+	Packets int64
+	Bytes   int64
+}
+
+func (s *trafficStats) add(p packet) {
+	s.Packets++
+	s.Bytes += int64(p.Length)
+}
+
+// trafficGroup is the traffic attributed to an asn
+type trafficGroup struct {
+	ASN       string `json:"as_number"`
+	ASName    string `json:"as_name"`
+	ASCountry string `json:"as_country"`
+	IPs       int    `json:"ips"`
+	Packets   int64  `json:"packets"`
+	Bytes     int64  `json:"bytes"`
+	Flows     int    `json:"flows"`
+
+	// flows are counted once per group, also when both ends belong to the asn
+	flows map[flowKey]struct{}
+}
+
+// processPcap attributes the packets, bytes and flows of the capture files to the
+// asns owning the source and destination ips
+func (r *Runner) processPcap(ctx context.Context) error {
+	flows := map[flowKey]*trafficStats{}
+	// ips holds the flows every address took part in
+	ips := map[netip.Addr]map[flowKey]struct{}{}
+	addFlow := func(addr netip.Addr, flow flowKey) {
+		if _, ok := ips[addr]; !ok {
+			ips[addr] = map[flowKey]struct{}{}
+		}
+		ips[addr][flow] = struct{}{}
+	}
+	for _, file := range r.options.Pcap {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		err = readCapture(f, func(p packet) {
+			flow := newFlowKey(p)
+			stats, ok := flows[flow]
+			if !ok {
+				stats = &trafficStats{}
+				flows[flow] = stats
+			}
+			stats.add(p)
+			addFlow(p.Src, flow)
+			addFlow(p.Dst, flow)
+		})
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("could not read '%s': %w", file, err)
+		}
+	}
+
+	addrs := make([]netip.Addr, 0, len(ips))
+	for addr := range ips {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Less(addrs[j]) })
+
+	r.stats.reset()
+	var cache responseCache
+	groups := map[int]*trafficGroup{}
+	for _, addr := range addrs {
+		// an interrupted run reports the ips looked up so far
+		if ctx.Err() != nil {
+			break
+		}
+		if !isRoutable(addr) {
+			continue
+		}
+		response, err := r.lookupReportTarget(addr.String(), &cache)
+		if err != nil {
+			return err
+		}
+		if response == nil {
+			continue
+		}
+		group, ok := groups[response.ASN]
+		if !ok {
+			group = &trafficGroup{
+				ASN:       fmt.Sprintf("AS%d", response.ASN),
+				ASName:    response.Org,
+				ASCountry: response.Country,
+				flows:     map[flowKey]struct{}{},
+			}
+			groups[response.ASN] = group
+		}
+		group.IPs++
+		for flow := range ips[addr] {
+			if _, ok := group.flows[flow]; ok {
+				continue
+			}
+			group.flows[flow] = struct{}{}
+			group.Packets += flows[flow].Packets
+			group.Bytes += flows[flow].Bytes
+		}
+	}
+
+	sorted := make([]*trafficGroup, 0, len(groups))
+	for _, group := range groups {
+		group.Flows = len(group.flows)
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Bytes != sorted[j].Bytes {
+			return sorted[i].Bytes > sorted[j].Bytes
+		}
+		return sorted[i].ASN < sorted[j].ASN
+	})
+	if err := r.writeTrafficGroups(sorted); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return r.failedInputsError()
+}
+
+func (r *Runner) writeTrafficGroups(groups []*trafficGroup) error {
+	if r.options.Output == nil {
+		return nil
+	}
+	switch {
+	case r.options.DisplayInJSON:
+		for _, group := range groups {
+			record, err := json.Marshal(group)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(r.options.Output, "%s\n", record); err != nil {
+				return err
+			}
+		}
+	case r.options.DisplayInCSV:
+		w := csv.NewWriter(r.options.Output)
+		w.Comma = '|'
+		if err := w.Write([]string{"as_number", "as_name", "as_country", "ips", "packets", "bytes", "flows"}); err != nil {
+			return err
+		}
+		for _, group := range groups {
+			record := []string{group.ASN, group.ASName, group.ASCountry, strconv.Itoa(group.IPs),
+				strconv.FormatInt(group.Packets, 10), strconv.FormatInt(group.Bytes, 10), strconv.Itoa(group.Flows)}
+			if err := w.Write(record); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		for _, group := range groups {
+			if _, err := fmt.Fprintf(r.options.Output, "%s [%s] [%s] ips=%d packets=%d bytes=%d flows=%d\n",
+				group.ASN, group.ASName, group.ASCountry, group.IPs, group.Packets, group.Bytes, group.Flows); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+// ipv4Frame builds an ethernet frame holding an ipv4 tcp packet
+func ipv4Frame(src, dst string, srcPort, dstPort uint16) []byte {
+	frame := make([]byte, 14+20+20)
+	binary.BigEndian.PutUint16(frame[12:], 0x0800)
+	ip := frame[14:]
+	ip[0] = 0x45
+	ip[9] = 6
+	s, d := netip.MustParseAddr(src).As4(), netip.MustParseAddr(dst).As4()
+	copy(ip[12:], s[:])
+	copy(ip[16:], d[:])
+	binary.BigEndian.PutUint16(ip[20:], srcPort)
+	binary.BigEndian.PutUint16(ip[22:], dstPort)
+	return frame
+}
+
+// ipv6Frame builds a raw ipv6 udp packet
+func ipv6Frame(src, dst string, srcPort, dstPort uint16) []byte {
+	ip := make([]byte, 40+8)
+	ip[0] = 0x60
+	ip[6] = 17
+	s, d := netip.MustParseAddr(src).As16(), netip.MustParseAddr(dst).As16()
+	copy(ip[8:], s[:])
+	copy(ip[24:], d[:])
+	binary.BigEndian.PutUint16(ip[40:], srcPort)
+	binary.BigEndian.PutUint16(ip[42:], dstPort)
+	return ip
+}
+
+func writePcap(order binary.ByteOrder, linkType uint32, frames ...[]byte) []byte {
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	order.PutUint32(header, pcapMagicMicro)
+	order.PutUint16(header[4:], 2)
+	order.PutUint16(header[6:], 4)
+	order.PutUint32(header[16:], 65535)
+	order.PutUint32(header[20:], linkType)
+	buf.Write(header)
+	for _, frame := range frames {
+		record := make([]byte, 16)
+		order.PutUint32(record[8:], uint32(len(frame)))
+		order.PutUint32(record[12:], uint32(len(frame)))
+		buf.Write(record)
+		buf.Write(frame)
+	}
+	return buf.Bytes()
+}
+
+func writePcapngBlock(buf *bytes.Buffer, blockType uint32, body []byte) {
+	for len(body)%4 != 0 {
+		body = append(body, 0)
+	}
+	length := make([]byte, 4)
+	binary.LittleEndian.PutUint32(length, uint32(12+len(body)))
+	typ := make([]byte, 4)
+	binary.LittleEndian.PutUint32(typ, blockType)
+	buf.Write(typ)
+	buf.Write(length)
+	buf.Write(body)
+	buf.Write(length)
+}
+
+func writePcapng(frames ...[]byte) []byte {
+	var buf bytes.Buffer
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb, pcapngBOM)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	writePcapngBlock(&buf, pcapngSHB, shb)
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb, linkTypeEthernet)
+	writePcapngBlock(&buf, pcapngIDB, idb)
+	writePcapngBlock(&buf, 0x00000005, make([]byte, 8)) // interface statistics are skipped
+
+	for _, frame := range frames {
+		epb := make([]byte, 20)
+		binary.LittleEndian.PutUint32(epb[12:], uint32(len(frame)))
+		binary.LittleEndian.PutUint32(epb[16:], uint32(len(frame)))
+		writePcapngBlock(&buf, pcapngEPB, append(epb, frame...))
+	}
+	return buf.Bytes()
+}
+
+func TestReadCapture(t *testing.T) {
+	frames := [][]byte{
+		ipv4Frame("192.168.1.10", "104.16.99.52", 50000, 443),
+		ipv4Frame("104.16.99.52", "192.168.1.10", 443, 50000),
+	}
+	expected := []packet{
+		{Src: netip.MustParseAddr("192.168.1.10"), Dst: netip.MustParseAddr("104.16.99.52"), Protocol: 6, SrcPort: 50000, DstPort: 443, Length: 54},
+		{Src: netip.MustParseAddr("104.16.99.52"), Dst: netip.MustParseAddr("192.168.1.10"), Protocol: 6, SrcPort: 443, DstPort: 50000, Length: 54},
+	}
+
+	tt := []struct {
+		name    string
+		capture []byte
+	}{
+		{"pcap little endian", writePcap(binary.LittleEndian, linkTypeEthernet, frames...)},
+		{"pcap big endian", writePcap(binary.BigEndian, linkTypeEthernet, frames...)},
+		{"pcapng", writePcapng(frames...)},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var packets []packet
+			require.Nil(t, readCapture(bytes.NewReader(tc.capture), func(p packet) { packets = append(packets, p) }))
+			require.Equal(t, expected, packets)
+		})
+	}
+
+	t.Run("raw ipv6", func(t *testing.T) {
+		var packets []packet
+		capture := writePcap(binary.LittleEndian, linkTypeRaw, ipv6Frame("2001:db8::1", "2606:4700::1", 5353, 53))
+		require.Nil(t, readCapture(bytes.NewReader(capture), func(p packet) { packets = append(packets, p) }))
+		require.Equal(t, []packet{{Src: netip.MustParseAddr("2001:db8::1"), Dst: netip.MustParseAddr("2606:4700::1"), Protocol: 17, SrcPort: 5353, DstPort: 53, Length: 48}}, packets)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		require.NotNil(t, readCapture(bytes.NewReader([]byte("not a capture file at all")), func(packet) {}))
+	})
+}
+
+func TestProcessPcap(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+		"ip=8.8.8.8":      {{FirstIp: "8.8.8.0", LastIp: "8.8.8.255", ASN: 15169, Country: "US", Org: "google"}},
+	})
+
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	require.Nil(t, os.WriteFile(file, writePcap(binary.LittleEndian, linkTypeEthernet,
+		ipv4Frame("192.168.1.10", "104.16.99.52", 50000, 443),
+		ipv4Frame("104.16.99.52", "192.168.1.10", 443, 50000),
+		ipv4Frame("192.168.1.10", "104.16.200.1", 50001, 443),
+		ipv4Frame("192.168.1.10", "8.8.8.8", 50002, 53),
+		// both ends belong to the same asn, the packet is counted once
+		ipv4Frame("104.16.99.52", "104.16.200.1", 443, 8443),
+	), 0600))
+
+	var buf bytes.Buffer
+	options := &Options{Pcap: []string{file}, Output: &buf}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.processPcap(context.Background()))
+	require.Nil(t, r.Close())
+
+	require.Equal(t, "AS13335 [cloudflarenet] [US] ips=2 packets=4 bytes=216 flows=3\n"+
+		"AS15169 [google] [US] ips=1 packets=1 bytes=54 flows=1\n", buf.String())
+}
+
+func TestProcessPcapLookupErrors(t *testing.T) {
+	server := newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+	handler := server.Config.Handler
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ip") == "8.8.8.8" {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+
+	file := filepath.Join(t.TempDir(), "capture.pcap")
+	require.Nil(t, os.WriteFile(file, writePcap(binary.LittleEndian, linkTypeEthernet,
+		ipv4Frame("192.168.1.10", "104.16.99.52", 50000, 443),
+		ipv4Frame("192.168.1.10", "8.8.8.8", 50002, 53),
+	), 0600))
+
+	// traffic of ips whose lookup failed fails the run instead of being left out
+	var buf bytes.Buffer
+	r, err := New(&Options{Pcap: []string{file}, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processPcap(context.Background()), ErrFailedInputs)
+	require.Equal(t, "AS13335 [cloudflarenet] [US] ips=1 packets=1 bytes=54 flows=1\n", buf.String())
+	require.Nil(t, r.Close())
+
+	status.Store(http.StatusUnauthorized)
+	r, err = New(&Options{Pcap: []string{file}, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processPcap(context.Background()), asnmap.ErrUnAuthorized)
+	require.Nil(t, r.Close())
+}
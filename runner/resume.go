@@ -0,0 +1,111 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// checkpointFlushInterval is how often completed inputs are persisted to the checkpoint file
+const checkpointFlushInterval = time.Second
+
+// checkpoint records the completed inputs of a run, one input store key per line,
+// so that an interrupted run can be resumed
+type checkpoint struct {
+	path string
+
+	mu        sync.Mutex
+	file      *os.File
+	writer    *bufio.Writer
+	completed map[string]struct{}
+	lastFlush time.Time
+}
+
+// openCheckpoint loads the inputs completed by a previous run (if any) and opens the
+// checkpoint file to append the inputs completed by this run
+func openCheckpoint(path string) (*checkpoint, error) {
+	c := &checkpoint{path: path, completed: make(map[string]struct{}), lastFlush: time.Now()}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open resume file: %w", err)
+	}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for scanner.Scan() {
+		if key := scanner.Text(); key != "" {
+			c.completed[key] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("could not read resume file: %w", err)
+	}
+
+	c.file = file
+	c.writer = bufio.NewWriter(file)
+	return c, nil
+}
+
+// Resumed returns the number of inputs completed by previous runs
+func (c *checkpoint) Resumed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.completed)
+}
+
+// Completed reports whether the input was completed by a previous run
+func (c *checkpoint) Completed(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.completed[key]
+	return ok
+}
+
+// Complete records a completed input, the checkpoint is flushed at most once per interval
+func (c *checkpoint) Complete(key string) error {
+	if strings.ContainsAny(key, "\r\n") {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return errors.New("resume file is closed")
+	}
+	c.completed[key] = struct{}{}
+	if _, err := c.writer.WriteString(key + "\n"); err != nil {
+		return err
+	}
+	if time.Since(c.lastFlush) < checkpointFlushInterval {
+		return nil
+	}
+	c.lastFlush = time.Now()
+	return c.writer.Flush()
+}
+
+// Close flushes and closes the checkpoint file
+func (c *checkpoint) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writer == nil {
+		return nil
+	}
+	err := c.writer.Flush()
+	if errClose := c.file.Close(); err == nil {
+		err = errClose
+	}
+	c.writer, c.file = nil, nil
+	return err
+}
+
+// Remove closes and deletes the checkpoint file once all inputs completed
+func (c *checkpoint) Remove() error {
+	if err := c.Close(); err != nil {
+		return err
+	}
+	return os.Remove(c.path)
+}
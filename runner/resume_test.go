@@ -0,0 +1,69 @@
+package runner
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resume.cfg")
+	c, err := openCheckpoint(path)
+	require.Nil(t, err)
+	require.Equal(t, 0, c.Resumed())
+	require.Nil(t, c.Complete("ip:1.1.1.1"))
+	require.Nil(t, c.Complete("org:google"))
+	require.True(t, c.Completed("ip:1.1.1.1"))
+	require.Nil(t, c.Close())
+	require.NotNil(t, c.Complete("ip:8.8.8.8"))
+
+	c, err = openCheckpoint(path)
+	require.Nil(t, err)
+	require.Equal(t, 2, c.Resumed())
+	require.True(t, c.Completed("org:google"))
+	require.False(t, c.Completed("ip:8.8.8.8"))
+	require.Nil(t, c.Remove())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+}
+
+func TestResume(t *testing.T) {
+	server := newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=20.0.1.1": {{FirstIp: "20.0.1.0", LastIp: "20.0.1.255", ASN: 1, Org: "first"}},
+		"ip=20.0.2.1": {{FirstIp: "20.0.2.0", LastIp: "20.0.2.255", ASN: 2, Org: "second"}},
+	})
+	var queried []string
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		queried = append(queried, req.URL.Query().Get("ip"))
+		handler.ServeHTTP(w, req)
+	})
+
+	dir := t.TempDir()
+	resumeFile, outputFile := filepath.Join(dir, "resume.cfg"), filepath.Join(dir, "output.txt")
+	// the interrupted run completed the first ip
+	require.Nil(t, os.WriteFile(resumeFile, []byte(encodeItem("20.0.1.1", asnmap.IP)+"\n"), 0600))
+	require.Nil(t, os.WriteFile(outputFile, []byte("20.0.1.0/24\n"), 0600))
+
+	options := &Options{
+		Ip:         []string{"20.0.1.1", "20.0.2.1"},
+		Resume:     resumeFile,
+		OutputFile: outputFile,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.Run())
+	require.Nil(t, r.Close())
+
+	require.Equal(t, []string{"20.0.2.1"}, queried)
+	output, err := os.ReadFile(outputFile)
+	require.Nil(t, err)
+	require.Equal(t, "20.0.1.0/24\n20.0.2.0/24\n", string(output))
+	// completed runs don't leave a resume file behind
+	_, err = os.Stat(resumeFile)
+	require.True(t, os.IsNotExist(err))
+}
@@ -2,23 +2,51 @@ package runner
 
 import (
 	"bufio"
+	"context"
 	"encoding/csv"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/netip"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	asnmap "github.com/projectdiscovery/asnmap/libs"
 	"github.com/projectdiscovery/gologger"
 	"github.com/projectdiscovery/hmap/store/hybrid"
 	fileutil "github.com/projectdiscovery/utils/file"
+	iputil "github.com/projectdiscovery/utils/ip"
 	sliceutil "github.com/projectdiscovery/utils/slice"
 )
 
 type Runner struct {
+	// mu serialises Close with writing the results of an item
+	mu      sync.Mutex
 	options *Options
 	hm      *hybrid.HybridMap
-	client  *asnmap.Client
+	// inputs is the number of items, their keys are stored in input order (see orderKey)
+	inputs    int
+	client    *asnmap.Client
+	proxyPool *asnmap.ProxyPool
+	// checkpoint records the completed inputs when resuming is enabled
+	checkpoint *checkpoint
+	// resumed is set once a run continued from the inputs completed by a previous one
+	resumed    bool
+	outputFile *os.File
+	// failedOutput receives the inputs that couldn't be looked up
+	failedOutput io.WriteCloser
+	stats        *runStats
+	// written holds the ranges already written when deduplicating
+	written map[string]struct{}
+	// aggregated collects the cidrs of the run when aggregating
+	aggregated []*net.IPNet
+	// exclusions are left out of the looked up responses
+	exclusions *exclusions
 }
 
 func New(options *Options) (*Runner, error) {
@@ -26,10 +54,65 @@ func New(options *Options) (*Runner, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Runner{options: options, client: client}, nil
+	if err := client.SetTLSOptions(asnmap.TLSOptions{
+		Insecure:       options.Insecure,
+		CAFile:         options.CAFile,
+		ClientCertFile: options.ClientCert,
+		ClientKeyFile:  options.ClientKey,
+		PinnedSPKI:     options.PinnedSPKI,
+	}); err != nil {
+		return nil, err
+	}
+	if options.Metrics != nil {
+		options.Metrics.Instrument(client)
+	}
+	r := &Runner{options: options, client: client, stats: newRunStats(), written: make(map[string]struct{})}
+	if len(options.Exclude) > 0 {
+		if r.exclusions, err = parseExclusions(options.Exclude); err != nil {
+			return nil, err
+		}
+	}
+	client.OnResponse(func(asnmap.RequestStats) {
+		r.stats.lookups.Add(1)
+	})
+	return r, nil
 }
 
 func (r *Runner) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.proxyPool != nil {
+		for _, stat := range r.proxyPool.Stats() {
+			gologger.Verbose().Msgf("proxy %s: healthy=%v requests=%d failures=%d %s", stat.URL, stat.Healthy, stat.Requests, stat.Failures, stat.LastError)
+		}
+		r.proxyPool.Close()
+		r.proxyPool = nil
+	}
+
+	if r.checkpoint != nil {
+		if err := r.checkpoint.Close(); err != nil {
+			gologger.Error().Msgf("could not save resume file: %s", err)
+		} else if _, err := os.Stat(r.checkpoint.path); err == nil {
+			gologger.Info().Msgf("Progress saved, continue with -resume %s", r.checkpoint.path)
+		}
+		r.checkpoint = nil
+	}
+
+	if r.failedOutput != nil {
+		if err := r.failedOutput.Close(); err != nil {
+			gologger.Error().Msgf("could not write failed output file: %s", err)
+		}
+		r.failedOutput = nil
+	}
+
+	if r.outputFile != nil {
+		if err := r.outputFile.Close(); err != nil {
+			gologger.Error().Msgf("could not write output file: %s", err)
+		}
+		r.outputFile = nil
+	}
+
 	if r.hm != nil {
 		err := r.hm.Close()
 		if err != nil {
@@ -40,111 +123,658 @@ func (r *Runner) Close() error {
 	return nil
 }
 
+// ErrInterrupted is returned when a run is cancelled before all inputs were processed
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrFailedInputs is returned when some inputs couldn't be looked up and the run continued on error
+var ErrFailedInputs = errors.New("failed inputs")
+
+// errInvalidInput fails inputs that don't match their declared type, they are reported
+// as failed inputs without stopping the run
+var errInvalidInput = errors.New("invalid input")
+
+// ExitCodeInterrupted is the exit code of the cli when a run is interrupted
+const ExitCodeInterrupted = 130
+
 func (r *Runner) Run() error {
-	if len(r.options.Proxy) > 0 {
-		if proxyURL, err := r.client.SetProxy(r.options.Proxy); err != nil {
-			return fmt.Errorf("could not set proxy: %s", err)
-		} else {
-			gologger.Info().Msgf("Using %s proxy %s", proxyURL.Scheme, proxyURL.String())
+	return r.RunWithContext(context.Background())
+}
+
+// RunWithContext runs asnmap until all inputs are processed or the context is cancelled.
+// On cancellation no new lookups are started, the in-flight ones are written and
+// ErrInterrupted is returned.
+func (r *Runner) RunWithContext(ctx context.Context) error {
+	if err := r.setupProxy(); err != nil {
+		return err
+	}
+
+	if r.options.Resume != "" && r.checkpoint == nil {
+		checkpoint, err := openCheckpoint(r.options.Resume)
+		if err != nil {
+			return err
+		}
+		r.checkpoint = checkpoint
+		if count := checkpoint.Resumed(); count > 0 {
+			r.resumed = true
+			gologger.Info().Msgf("Resuming from %s, skipping %d completed inputs", r.options.Resume, count)
 		}
 	}
+	resumed := r.resumed
 
 	var outputWriters []io.Writer
 	if r.options.OutputFile != "" {
-		file, err := os.Create(r.options.OutputFile)
+		file, err := openOutputFile(r.outputFile, r.options.OutputFile, resumed)
 		if err != nil {
 			return err
 		}
+		r.outputFile = file
 		outputWriters = append(outputWriters, file)
 	}
 
+	if r.options.FailedOutput != "" {
+		previous, _ := r.failedOutput.(*os.File)
+		if r.failedOutput == nil || previous != nil {
+			file, err := openOutputFile(previous, r.options.FailedOutput, resumed)
+			if err != nil {
+				return err
+			}
+			r.failedOutput = file
+		}
+	}
+
 	outputWriters = append(outputWriters, os.Stdout)
 	r.options.Output = io.MultiWriter(outputWriters...)
 
-	if r.options.DisplayInCSV {
+	if r.options.Enrich {
+		var input io.Reader
+		if fileutil.HasStdin() {
+			input = os.Stdin
+		}
+		return r.enrich(ctx, input)
+	}
+
+	if len(r.options.Logs) > 0 {
+		return r.processLogs(ctx)
+	}
+
+	if len(r.options.Pcap) > 0 {
+		return r.processPcap(ctx)
+	}
+
+	if r.options.InputFormat == inputFormatNmap || r.options.InputFormat == inputFormatMasscan {
+		var input io.Reader
+		if fileutil.HasStdin() {
+			input = os.Stdin
+		}
+		lines, err := r.readLines(input)
+		if err != nil {
+			return err
+		}
+		return r.processScan(ctx, lines)
+	}
+
+	if err := r.prepareInput(); err != nil {
+		return err
+	}
+
+	if r.options.Explain {
+		return r.explain()
+	}
+
+	if r.options.DisplayInCSV && !resumed {
 		w := csv.NewWriter(r.options.Output)
 		w.Comma = '|'
 
-		for _, record := range csvHeaders {
-			if err := w.Write(record); err != nil {
-				return err
-			}
+		if err := w.Write(r.csvHeader()); err != nil {
+			return err
 		}
 		w.Flush()
 	}
 
-	if err := r.prepareInput(); err != nil {
+	err := r.process(ctx)
+	if errors.Is(err, ErrInterrupted) {
+		gologger.Info().Msgf("Interrupted: processed %d of %d inputs (%d failed)", r.stats.processed.Load(), r.stats.total.Load(), r.stats.failed.Load())
+	}
+	if errSummary := r.writeSummary(); errSummary != nil && err == nil {
+		err = errSummary
+	}
+	if err != nil {
+		return err
+	}
+	// all inputs completed, nothing left to resume
+	if r.checkpoint != nil {
+		err := r.checkpoint.Remove()
+		r.checkpoint = nil
 		return err
 	}
+	return nil
+}
 
-	return r.process()
+// openOutputFile opens an output file, truncated unless the run is resumed. A file opened
+// by a previous run of the runner (e.g. before authenticating) is reused and started over.
+func openOutputFile(file *os.File, path string, resumed bool) (*os.File, error) {
+	if file != nil {
+		if resumed {
+			return file, nil
+		}
+		if err := file.Truncate(0); err != nil {
+			return nil, err
+		}
+		_, err := file.Seek(0, io.SeekStart)
+		return file, err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	// a resumed run appends to the output of the interrupted one
+	if resumed {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	return os.OpenFile(path, flags, 0644)
 }
 
-// Process Function makes request to client returns response
-func (r *Runner) process() error {
-	var errProcess error
-	r.hm.Scan(func(key, _ []byte) error {
-		item := string(key)
-		switch asnmap.IdentifyInput(item) {
-		case asnmap.Domain:
-			resolvedIps, err := asnmap.ResolveDomain(item, r.options.Resolvers...)
-			if err != nil {
-				gologger.Verbose().Msgf("could not resolve '%s': %v", item, err)
-				return nil
-			}
+// setupProxy configures the proxy pool from the proxy option or the HTTP(S)_PROXY and NO_PROXY env vars
+func (r *Runner) setupProxy() error {
+	proxies, fromEnv := r.options.Proxy, false
+	if len(proxies) == 0 {
+		proxies, fromEnv = asnmap.ProxiesFromEnv(), true
+	}
+	if len(proxies) == 0 || r.proxyPool != nil {
+		return nil
+	}
 
-			if len(resolvedIps) == 0 {
-				gologger.Verbose().Msgf("No records found for %v", item)
-				return nil
-			}
+	pool, err := r.client.SetProxyPool(proxies)
+	if err != nil {
+		// an unreachable environment proxy falls back to direct connections
+		if fromEnv {
+			gologger.Warning().Msgf("Could not use proxy from environment, connecting directly: %s", err)
+			return nil
+		}
+		return fmt.Errorf("could not set proxy: %s", err)
+	}
+	pool.StartHealthChecks(r.options.ProxyCheckInterval)
+	r.proxyPool = pool
+	gologger.Info().Msgf("Using %d/%d healthy proxies", pool.Healthy(), pool.Len())
+	return nil
+}
 
-			var responses []asnmap.Response
-			for _, resolvedIp := range resolvedIps {
-				ls, err := r.client.GetDataWithCustomInput(resolvedIp, item)
-				if err != nil {
-					errProcess = err
-					break
-				}
+// Process Function makes request to client returns response. Items are looked up by
+// a pool of workers while the results are written in input order (or sorted, see -sort).
+func (r *Runner) process(ctx context.Context) error {
+	concurrency := r.options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	// the checkpoint is read by the feeder, Close may reset the field concurrently
+	checkpoint := r.checkpoint
 
-				for _, l := range ls {
-					if !sliceutil.Contains(responses, *l) {
-						responses = append(responses, *l)
+	var (
+		wg      sync.WaitGroup
+		stop    atomic.Bool
+		jobs    = make(chan queuedItem)
+		results = make(chan queuedItem)
+		// window bounds how far lookups may run ahead of the next item to write
+		window = make(chan struct{}, concurrency*outputWindowFactor)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				if !stop.Load() {
+					job.result = r.lookupItem(job.item)
+					if r.exclusions != nil {
+						job.result.responses = r.exclusions.apply(job.result.responses)
+					}
+					job.done = true
+					// client-wide errors fail every following lookup as well
+					if isFatalError(job.result.err) {
+						stop.Store(true)
 					}
 				}
+				results <- job
 			}
+		}()
+	}
 
-			for _, response := range responses {
-				if err := r.writeOutput([]*asnmap.Response{&response}); err != nil {
-					errProcess = err
-					return err
-				}
+	r.stats.reset()
+	r.written = make(map[string]struct{})
+	r.aggregated = nil
+	for n := 0; n < r.inputs; n++ {
+		if key := r.inputKey(n); checkpoint == nil || !checkpoint.Completed(key) {
+			r.stats.total.Add(1)
+		}
+	}
+	if r.options.Stats {
+		stopProgress, progressDone := make(chan struct{}), make(chan struct{})
+		go func() {
+			r.stats.showProgress(os.Stderr, r.options.StatsInterval, stopProgress)
+			close(progressDone)
+		}()
+		defer func() {
+			close(stopProgress)
+			<-progressDone
+		}()
+	}
+
+	go func() {
+		seq := 0
+		for n := 0; n < r.inputs; n++ {
+			if stop.Load() || ctx.Err() != nil {
+				break
 			}
+			key := r.inputKey(n)
+			if checkpoint != nil && checkpoint.Completed(key) {
+				continue
+			}
+			value, _ := r.hm.Get(key)
+			item, declared := decodeItem(key)
+			inputType, _ := resolveInputType(item, declared)
+			window <- struct{}{}
+			jobs <- queuedItem{seq: seq, key: key, item: inputItem{value: item, inputType: inputType, records: r.itemRecords(key, decodeItemMeta(value))}}
+			seq++
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
 
-		default:
-			ls, err := r.client.GetData(item)
-			if err != nil {
+	var (
+		errProcess error
+		next       int
+		pending    = make(map[int]queuedItem)
+		sorted     []sortedResponse
+		// sortedKeys are completed once the sorted responses are written
+		sortedKeys []string
+	)
+	// writeJob writes the result of the next item in input order, Close waits for it
+	writeJob := func(job queuedItem) {
+		// items looked up ahead are dropped once processing failed
+		if !job.done || errProcess != nil {
+			return
+		}
+		r.stats.processed.Add(1)
+		if isFatalError(job.result.err) {
+			errProcess = job.result.err
+			stop.Store(true)
+			return
+		}
+		if job.result.err != nil {
+			r.stats.failed.Add(1)
+			gologger.Error().Msgf("Could not lookup '%s': %s", job.item.value, job.result.err)
+			if err := r.writeFailure(job.item, job.result.err); err != nil {
 				errProcess = err
-				return err
+				stop.Store(true)
+				return
 			}
-			if len(ls) == 0 {
-				gologger.Verbose().Msgf("No records found for %v", item)
-				return nil
+			if !r.options.ContinueOnError && !errors.Is(job.result.err, errInvalidInput) {
+				errProcess = job.result.err
+				stop.Store(true)
 			}
-			if err := r.writeOutput(ls); err != nil {
-				errProcess = err
-				return err
+			// failed items are neither written nor completed, so that they can be retried
+			return
+		}
+		r.stats.observe(job.item, job.result.responses)
+
+		var err error
+		// sorted and aggregated output is written once all lookups completed
+		if (r.options.Sort == sortByInput || r.options.Sort == "") && !r.options.Aggregate {
+			err = r.writeItemResult(job.item, job.result)
+			if err == nil {
+				err = r.completeItem(job.key)
+			}
+		} else {
+			sorted = appendSortedResponses(sorted, job)
+			sortedKeys = append(sortedKeys, job.key)
+		}
+		if err != nil {
+			errProcess = err
+			stop.Store(true)
+		}
+	}
+	for job := range results {
+		pending[job.seq] = job
+		for {
+			job, ok := pending[next]
+			if !ok {
+				break
 			}
+			delete(pending, next)
+			next++
+			<-window
+			r.mu.Lock()
+			writeJob(job)
+			r.mu.Unlock()
 		}
+	}
 
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(sorted) > 0 {
+		if err := r.writeSortedResponses(sorted); err != nil {
+			return err
+		}
+	}
+	if r.options.Aggregate {
+		if err := r.writeAggregated(); err != nil {
+			return err
+		}
+	}
+	for _, key := range sortedKeys {
+		if err := r.completeItem(key); err != nil {
+			return err
+		}
+	}
+	switch {
+	case errProcess != nil:
+		return errProcess
+	case ctx.Err() != nil:
+		return ErrInterrupted
+	}
+	return r.failedInputsError()
+}
+
+// failedInputsError reports the inputs that couldn't be looked up, if any
+func (r *Runner) failedInputsError() error {
+	if failed := r.stats.failed.Load(); failed > 0 {
+		return fmt.Errorf("%w: %d of %d inputs", ErrFailedInputs, failed, r.stats.total.Load())
+	}
+	return nil
+}
+
+// isFatalError reports whether the error affects every lookup rather than a single input,
+// such errors stop the run even with continue on error
+func isFatalError(err error) bool {
+	return errors.Is(err, asnmap.ErrUnAuthorized)
+}
+
+// completeItem records a completed input item in the resume file
+func (r *Runner) completeItem(key string) error {
+	if r.checkpoint == nil {
 		return nil
-	})
-	return errProcess
+	}
+	return r.checkpoint.Complete(key)
+}
+
+// outputWindowFactor times the concurrency is the number of items looked up ahead of the writer
+const outputWindowFactor = 64
+
+// queuedItem is an input item along with its position in the input
+type queuedItem struct {
+	seq    int
+	key    string
+	item   inputItem
+	result itemResult
+	// done is unset for items skipped after processing stopped
+	done bool
+}
+
+// inputItem is an input item queued for lookup
+type inputItem struct {
+	value     string
+	inputType asnmap.InputType
+	records   []string
+}
+
+// itemResult holds the responses of an input item
+type itemResult struct {
+	responses []*asnmap.Response
+	// resolved is set for domain, url and email items, whose responses are written one by one
+	resolved bool
+	err      error
+}
+
+// lookupItem looks up a single input item
+func (r *Runner) lookupItem(item inputItem) itemResult {
+	if err := validateItem(item); err != nil {
+		return itemResult{err: err}
+	}
+	switch item.inputType {
+	case asnmap.Domain, asnmap.URL, asnmap.Email:
+		result := itemResult{resolved: true}
+		resolvedIps, err := r.resolve(item.value, item.inputType)
+		if err != nil {
+			if r.options.Metrics != nil {
+				r.options.Metrics.Error()
+			}
+			result.err = fmt.Errorf("could not resolve: %w", err)
+			return result
+		}
+
+		if len(resolvedIps) == 0 {
+			gologger.Verbose().Msgf("No records found for %v", item.value)
+			return result
+		}
+
+		var responses []asnmap.Response
+		for _, resolvedIp := range resolvedIps {
+			ls, err := r.client.GetDataWithCustomInput(resolvedIp, item.value)
+			if err != nil {
+				// partial results are dropped, the whole item is retried from the failures report
+				result.err = err
+				return result
+			}
+
+			for _, l := range ls {
+				if l.Annotation != "" {
+					gologger.Verbose().Msgf("Skipped lookup for %s (%s): %s", resolvedIp, item.value, l.Annotation)
+				}
+				l.InputType = item.inputType.String()
+				if !sliceutil.Contains(responses, *l) {
+					responses = append(responses, *l)
+				}
+			}
+		}
+		for i := range responses {
+			result.responses = append(result.responses, &responses[i])
+		}
+		return result
+
+	default:
+		ls, err := r.client.GetDataAs(item.value, item.inputType)
+		if err != nil {
+			return itemResult{err: err}
+		}
+		if len(ls) == 0 {
+			gologger.Verbose().Msgf("No records found for %v", item.value)
+			return itemResult{}
+		}
+		for _, l := range ls {
+			if l.Annotation != "" {
+				gologger.Verbose().Msgf("Skipped lookup for %s: %s", item.value, l.Annotation)
+			}
+		}
+		return itemResult{responses: ls}
+	}
+}
+
+// writeItemResult writes the responses of an item, the caller serialises the writes
+func (r *Runner) writeItemResult(item inputItem, result itemResult) error {
+	if !result.resolved {
+		if len(result.responses) == 0 {
+			return nil
+		}
+		return r.writeResults(result.responses, item.records)
+	}
+	for _, response := range result.responses {
+		if err := r.writeResults([]*asnmap.Response{response}, item.records); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (r *Runner) setItem(v string) {
+// resolve returns the ips behind domain, url and email inputs
+func (r *Runner) resolve(item string, inputType asnmap.InputType) ([]string, error) {
+	var resolve func(string, ...string) ([]string, error)
+	switch inputType {
+	case asnmap.URL:
+		item = asnmap.HostFromURL(item)
+		if iputil.IsIP(item) {
+			return []string{item}, nil
+		}
+		resolve = asnmap.ResolveDomain
+	case asnmap.Email:
+		resolve = asnmap.ResolveEmail
+	default:
+		resolve = asnmap.ResolveDomain
+	}
+
+	if r.options.Metrics != nil {
+		r.options.Metrics.DNSResolution()
+	}
+	return resolve(item, r.options.Resolvers...)
+}
+
+// isRoutable reports whether an address can be announced, private and other
+// special purpose addresses are never looked up
+func isRoutable(addr netip.Addr) bool {
+	return addr.IsValid() && asnmap.SpecialPurposeIP(addr.String()) == ""
+}
+
+// validateItem checks that asn and ip items hold a value of their type, as items with a
+// declared type skip detection (e.g. -a foo)
+func validateItem(item inputItem) error {
+	identified := asnmap.IdentifyInput(item.value)
+	switch item.inputType {
+	case asnmap.ASN:
+		if identified != asnmap.ASN && identified != asnmap.ASNID && identified != asnmap.ASNRange {
+			return fmt.Errorf("%w: '%s' is not an asn", errInvalidInput, item.value)
+		}
+	case asnmap.IP:
+		if identified != asnmap.IP && identified != asnmap.CIDR && identified != asnmap.IPRange {
+			return fmt.Errorf("%w: '%s' is not an ip, cidr or ip range", errInvalidInput, item.value)
+		}
+	}
+	return nil
+}
+
+// resolveInputType returns the type an item is processed as and why, the reason is empty
+// when the declared type is kept as is. Items given through
+// a typed option or prefix keep the declared type, only narrowed to a more specific type
+// of the same family (e.g. a cidr given with -ip), so that -org google.com is queried as an org.
+func resolveInputType(item string, declared asnmap.InputType) (asnmap.InputType, string) {
+	identified, reason := asnmap.ExplainInput(item)
+	switch declared {
+	case asnmap.Unknown:
+		return identified, reason
+	case asnmap.ASN:
+		if identified == asnmap.ASNID || identified == asnmap.ASNRange {
+			return identified, reason
+		}
+	case asnmap.IP:
+		if identified == asnmap.CIDR || identified == asnmap.IPRange {
+			return identified, reason
+		}
+	case asnmap.Domain:
+		if identified == asnmap.URL || identified == asnmap.Email {
+			return identified, reason
+		}
+	}
+	return declared, ""
+}
+
+// orderKey is the input store key holding the key of the n-th item, so that the input
+// order is kept on disk along with the items
+func orderKey(n int) string {
+	return "\x00order\x00" + strconv.Itoa(n)
+}
+
+// inputKey returns the key of the n-th item
+func (r *Runner) inputKey(n int) string {
+	key, _ := r.hm.Get(orderKey(n))
+	return string(key)
+}
+
+// encodeItem builds the input store key, prefixed with the declared type name if any
+func encodeItem(item string, declared asnmap.InputType) string {
+	if declared == asnmap.Unknown {
+		return ":" + item
+	}
+	return declared.String() + ":" + item
+}
+
+func decodeItem(key string) (string, asnmap.InputType) {
+	typeName, item, _ := strings.Cut(key, ":")
+	if typeName == "" {
+		return item, asnmap.Unknown
+	}
+	declared, err := asnmap.ParseInputType(typeName)
+	if err != nil {
+		return item, asnmap.Unknown
+	}
+	return item, declared
+}
+
+// setItem stores an input item along with its declared type, where the type was
+// declared and the jsonl record it was extracted from (if any)
+func (r *Runner) setItem(v string, declared asnmap.InputType, source string, record string) {
 	item := strings.TrimSpace(v)
-	if item != "" {
-		_ = r.hm.Set(item, nil)
+	if item == "" {
+		return
+	}
+	key := encodeItem(item, declared)
+	meta := itemMeta{Source: source}
+	if existing, ok := r.hm.Get(key); ok {
+		meta = decodeItemMeta(existing)
+	} else {
+		if err := r.hm.Set(orderKey(r.inputs), []byte(key)); err != nil {
+			return
+		}
+		r.inputs++
+	}
+	if record != "" {
+		r.addRecord(key, &meta, record)
+	}
+	value, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+	_ = r.hm.Set(key, value)
+}
+
+// setUntypedItem stores an item from stdin or file input, honouring an explicit
+// type prefix (e.g. org:AS Networks) or the -input-type option
+func (r *Runner) setUntypedItem(v string, record string) {
+	item := strings.TrimSpace(v)
+	if record == "" {
+		if value, declared, ok := asnmap.ParseTypePrefix(item); ok {
+			r.setItem(value, declared, fmt.Sprintf("'%s:' prefix", declared), record)
+			return
+		}
+	}
+	if r.options.InputType != "" {
+		if declared, err := asnmap.ParseInputType(r.options.InputType); err == nil {
+			r.setItem(item, declared, "-input-type option", record)
+			return
+		}
+	}
+	r.setItem(item, asnmap.Unknown, "", record)
+}
+
+// setLine stores a line of stdin or file input according to the input format
+func (r *Runner) setLine(line string) {
+	if r.options.InputFormat != inputFormatJSONL {
+		// comments, e.g. the error reasons of a failures report
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			return
+		}
+		r.setUntypedItem(line, "")
+		return
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &record); err != nil {
+		gologger.Verbose().Msgf("Skipping invalid jsonl record '%s': %v", line, err)
+		return
+	}
+	for _, selector := range r.options.InputField {
+		for _, field := range extractFields(record, selector) {
+			r.setUntypedItem(field, line)
+		}
 	}
 }
 
@@ -154,32 +784,58 @@ func (r *Runner) prepareInput() error {
 	if err != nil {
 		return err
 	}
+	r.inputs = 0
 	if fileutil.HasStdin() {
 		scanner := bufio.NewScanner(os.Stdin)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
 		for scanner.Scan() {
-			r.setItem(scanner.Text())
+			r.setLine(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("could not read input from stdin: %w", err)
 		}
 	}
 
 	for _, item := range r.options.FileInput {
-		r.setItem(item)
+		r.setLine(item)
 	}
 
 	for _, item := range r.options.Asn {
-		r.setItem(item)
+		r.setItem(item, asnmap.ASN, "-asn option", "")
 	}
 
 	for _, item := range r.options.Ip {
-		r.setItem(item)
+		r.setItem(item, asnmap.IP, "-ip option", "")
 	}
 
 	for _, item := range r.options.Domain {
-		r.setItem(item)
+		r.setItem(item, asnmap.Domain, "-domain option", "")
 	}
 
 	for _, item := range r.options.Org {
-		r.setItem(item)
+		r.setItem(item, asnmap.Org, "-org option", "")
 	}
 
 	return nil
 }
+
+// explain writes how every input is classified instead of looking it up, in input order
+func (r *Runner) explain() error {
+	for n := 0; n < r.inputs; n++ {
+		key := r.inputKey(n)
+		value, _ := r.hm.Get(key)
+		item, declared := decodeItem(key)
+		inputType, reason := resolveInputType(item, declared)
+		if source := decodeItemMeta(value).Source; source != "" {
+			if reason == "" {
+				reason = "declared by " + source
+			} else {
+				reason = fmt.Sprintf("%s, narrowed from %s declared by %s", reason, declared, source)
+			}
+		}
+		if err := r.writeExplanation(item, inputType, reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
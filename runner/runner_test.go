@@ -1,7 +1,19 @@
 package runner
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	asnmap "github.com/projectdiscovery/asnmap/libs"
@@ -22,12 +34,13 @@ func TestRunner(t *testing.T) {
 			},
 			expectedOutput: []*asnmap.Response{
 				{
-					FirstIp: "104.16.0.0",
-					LastIp:  "104.22.79.255",
-					Input:   "104.16.99.52",
-					ASN:     13335,
-					Country: "US",
-					Org:     "cloudflarenet"},
+					FirstIp:   "104.16.0.0",
+					LastIp:    "104.22.79.255",
+					Input:     "104.16.99.52",
+					InputType: "ip",
+					ASN:       13335,
+					Country:   "US",
+					Org:       "cloudflarenet"},
 			},
 		},
 		{
@@ -37,12 +50,13 @@ func TestRunner(t *testing.T) {
 			},
 			expectedOutput: []*asnmap.Response{
 				{
-					FirstIp: "216.101.17.0",
-					LastIp:  "216.101.17.255",
-					Input:   "14421",
-					ASN:     14421,
-					Country: "US",
-					Org:     "theravance"},
+					FirstIp:   "216.101.17.0",
+					LastIp:    "216.101.17.255",
+					Input:     "14421",
+					InputType: "asn",
+					ASN:       14421,
+					Country:   "US",
+					Org:       "theravance"},
 			},
 		},
 		{
@@ -52,19 +66,21 @@ func TestRunner(t *testing.T) {
 			},
 			expectedOutput: []*asnmap.Response{
 				{
-					FirstIp: "45.239.52.0",
-					LastIp:  "45.239.55.255",
-					Input:   "PPLINK",
-					ASN:     268353,
-					Country: "BR",
-					Org:     "PPLINKNET SERVICOS DE COMUNICACAO LTDA - ME"},
+					FirstIp:   "45.239.52.0",
+					LastIp:    "45.239.55.255",
+					Input:     "PPLINK",
+					InputType: "org",
+					ASN:       268353,
+					Country:   "BR",
+					Org:       "PPLINKNET SERVICOS DE COMUNICACAO LTDA - ME"},
 				{
-					FirstIp: "2804:4fd8::",
-					LastIp:  "2804:4fd8:ffff:ffff:ffff:ffff:ffff:ffff",
-					Input:   "PPLINK",
-					ASN:     268353,
-					Country: "BR",
-					Org:     "PPLINKNET SERVICOS DE COMUNICACAO LTDA - ME"},
+					FirstIp:   "2804:4fd8::",
+					LastIp:    "2804:4fd8:ffff:ffff:ffff:ffff:ffff:ffff",
+					Input:     "PPLINK",
+					InputType: "org",
+					ASN:       268353,
+					Country:   "BR",
+					Org:       "PPLINKNET SERVICOS DE COMUNICACAO LTDA - ME"},
 			},
 		},
 	}
@@ -80,7 +96,7 @@ func TestRunner(t *testing.T) {
 			err = r.prepareInput()
 			require.Nil(t, err)
 
-			err = r.process()
+			err = r.process(context.Background())
 			require.Nil(t, err)
 
 			err = r.Close()
@@ -90,37 +106,107 @@ func TestRunner(t *testing.T) {
 }
 
 func TestProcessForDomainInput(t *testing.T) {
+	dnsServer, err := asnmap.NewStubDNSServer(asnmap.DNSRecords{
+		A: map[string][]string{
+			"google.com":      {"142.250.1.100", "142.250.1.101"},
+			"smtp.google.com": {"142.250.1.102"},
+		},
+		MX: map[string][]string{
+			"example.org": {"smtp.google.com"},
+		},
+	})
+	require.Nil(t, err)
+	defer dnsServer.Close()
+
+	google := &asnmap.Response{
+		FirstIp: "142.250.0.0",
+		LastIp:  "142.250.82.255",
+		ASN:     15169,
+		Country: "US",
+		Org:     "google",
+	}
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=142.250.1.100": {google},
+		"ip=142.250.1.101": {google},
+		"ip=142.250.1.102": {google},
+	})
+
 	tests := []struct {
 		name           string
-		inputchan      chan interface{}
-		outputchan     chan []*asnmap.Response
 		options        *Options
 		expectedOutput *asnmap.Response
 	}{
 		{
-			name:       "Domain",
-			inputchan:  make(chan interface{}),
-			outputchan: make(chan []*asnmap.Response),
+			name: "Domain",
+			options: &Options{
+				Domain:    []string{"google.com"},
+				Resolvers: []string{dnsServer.Addr()},
+			},
+			expectedOutput: &asnmap.Response{
+				FirstIp:   "142.250.0.0",
+				LastIp:    "142.250.82.255",
+				Input:     "google.com",
+				InputType: "domain",
+				ASN:       15169,
+				Country:   "US",
+				Org:       "google",
+			},
+		},
+		{
+			name: "URL",
 			options: &Options{
-				Domain: []string{"google.com"},
+				Domain:    []string{"https://google.com:8443/path"},
+				Resolvers: []string{dnsServer.Addr()},
 			},
 			expectedOutput: &asnmap.Response{
-				FirstIp: "142.250.0.0",
-				LastIp:  "142.250.82.255",
-				Input:   "google.com",
-				ASN:     15169,
-				Country: "US",
-				Org:     "google",
+				FirstIp:   "142.250.0.0",
+				LastIp:    "142.250.82.255",
+				Input:     "https://google.com:8443/path",
+				InputType: "url",
+				ASN:       15169,
+				Country:   "US",
+				Org:       "google",
+			},
+		},
+		{
+			name: "URL with ip host",
+			options: &Options{
+				Domain: []string{"http://142.250.1.101/index.html"},
+			},
+			expectedOutput: &asnmap.Response{
+				FirstIp:   "142.250.0.0",
+				LastIp:    "142.250.82.255",
+				Input:     "http://142.250.1.101/index.html",
+				InputType: "url",
+				ASN:       15169,
+				Country:   "US",
+				Org:       "google",
+			},
+		},
+		{
+			name: "Email",
+			options: &Options{
+				Domain:    []string{"someone@example.org"},
+				Resolvers: []string{dnsServer.Addr()},
+			},
+			expectedOutput: &asnmap.Response{
+				FirstIp:   "142.250.0.0",
+				LastIp:    "142.250.82.255",
+				Input:     "someone@example.org",
+				InputType: "email",
+				ASN:       15169,
+				Country:   "US",
+				Org:       "google",
 			},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var calls int
 			tt.options.OnResult = func(o []*asnmap.Response) {
-				x := compareResponse(o, tt.expectedOutput)
-				// // Expecting true from comparision
-				require.True(t, x)
+				calls++
+				require.Equal(t, []*asnmap.Response{tt.expectedOutput}, o)
 			}
 
 			r, err := New(tt.options)
@@ -129,15 +215,89 @@ func TestProcessForDomainInput(t *testing.T) {
 			err = r.prepareInput()
 			require.Nil(t, err)
 
-			err = r.process()
+			err = r.process(context.Background())
 			require.Nil(t, err)
 
 			err = r.Close()
 			require.Nil(t, err)
+
+			// identical responses for the resolved ips are reported once
+			require.Equal(t, 1, calls)
 		})
 	}
 }
 
+func TestProcessForMixedInput(t *testing.T) {
+	dnsServer, err := asnmap.NewStubDNSServer(asnmap.DNSRecords{
+		A: map[string][]string{
+			"google.com": {"142.250.1.100"},
+		},
+	})
+	require.Nil(t, err)
+	defer dnsServer.Close()
+
+	google := &asnmap.Response{FirstIp: "142.250.0.0", LastIp: "142.250.82.255", ASN: 15169, Country: "US", Org: "google"}
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=142.250.1.100": {google},
+		"ip=104.16.99.52":  {{FirstIp: "104.16.0.0", LastIp: "104.22.79.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+		"asn=14421":        {{FirstIp: "216.101.17.0", LastIp: "216.101.17.255", ASN: 14421, Country: "US", Org: "theravance"}},
+		"org=google.com":   {{FirstIp: "8.8.8.0", LastIp: "8.8.8.255", ASN: 15169, Country: "US", Org: "google.com"}},
+		"org=as networks":  {{FirstIp: "192.0.2.0", LastIp: "192.0.2.255", ASN: 64501, Country: "US", Org: "as networks"}},
+	})
+
+	options := &Options{
+		Asn:       []string{"AS14421"},
+		Ip:        []string{"104.16.99.52"},
+		Org:       []string{"google.com", "AS Networks"},
+		Domain:    []string{"google.com"},
+		Resolvers: []string{dnsServer.Addr()},
+	}
+	results := map[string]string{}
+	options.OnResult = func(o []*asnmap.Response) {
+		for _, response := range o {
+			results[response.Input+"|"+response.Org] = response.InputType
+		}
+	}
+
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.process(context.Background()))
+	require.Nil(t, r.Close())
+
+	require.Equal(t, map[string]string{
+		"14421|theravance":           "asn",
+		"104.16.99.52|cloudflarenet": "ip",
+		"google.com|google.com":      "org",
+		"AS Networks|as networks":    "org",
+		"google.com|google":          "domain",
+	}, results)
+}
+
+// newStubAPIServer starts a fake asnmap api answering from responses keyed by the
+// query parameter (e.g. "ip=1.2.3.4") and points the client at it via SERVER_URL
+func newStubAPIServer(t *testing.T, responses map[string][]*asnmap.Response) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body []*asnmap.Response
+		for _, key := range []string{"ip", "asn", "org"} {
+			if value := req.URL.Query().Get(key); value != "" {
+				body = responses[key+"="+value]
+			}
+		}
+		if body == nil {
+			body = []*asnmap.Response{}
+		}
+		_ = json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("SERVER_URL", server.URL)
+	apiKey := asnmap.PDCPApiKey
+	asnmap.PDCPApiKey = "test-api-key"
+	t.Cleanup(func() { asnmap.PDCPApiKey = apiKey })
+	return server
+}
+
 // compareResponse compares ASN & ORG against given domain with expected output's ASN & ORG
 // Have excluded IPs for now as they might change in future.
 func compareResponse(respA []*asnmap.Response, respB *asnmap.Response) bool {
@@ -149,3 +309,452 @@ func compareResponse(respA []*asnmap.Response, respB *asnmap.Response) bool {
 
 	return false
 }
+
+func TestExplain(t *testing.T) {
+	var buf bytes.Buffer
+	options := &Options{
+		FileInput: []string{"org:AS Networks", "domain:1password.com", "1.2.3.0/22", "AS"},
+		Ip:        []string{"1.2.3.4-1.2.5.9"},
+		Org:       []string{"google.com"},
+		Output:    &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.explain())
+	require.Nil(t, r.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	require.Equal(t, []string{
+		"1.2.3.0/22 => cidr (valid cidr notation)",
+		"1.2.3.4-1.2.5.9 => ip_range (range of two ips of the same family, narrowed from ip declared by -ip option)",
+		"1password.com => domain (declared by 'domain:' prefix)",
+		"AS => org (no other input type matched, treated as organization name)",
+		"AS Networks => org (declared by 'org:' prefix)",
+		"google.com => org (declared by -org option)",
+	}, lines)
+
+	buf.Reset()
+	options.FileInput = []string{"12345", "asn:AS14421"}
+	options.Ip, options.Org = nil, nil
+	options.InputType = "org"
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.explain())
+	require.Nil(t, r.Close())
+
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	sort.Strings(lines)
+	require.Equal(t, []string{
+		"12345 => org (declared by -input-type option)",
+		"AS14421 => asn (declared by 'asn:' prefix)",
+	}, lines)
+}
+
+func TestProcessConcurrently(t *testing.T) {
+	responses := map[string][]*asnmap.Response{}
+	var ips, cidrs []string
+	for i := 1; i <= 50; i++ {
+		ip := fmt.Sprintf("20.0.%d.1", i)
+		ips = append(ips, ip)
+		cidrs = append(cidrs, fmt.Sprintf("20.0.%d.0/24", i))
+		responses["ip="+ip] = []*asnmap.Response{{FirstIp: fmt.Sprintf("20.0.%d.0", i), LastIp: fmt.Sprintf("20.0.%d.255", i), ASN: i, Org: "org"}}
+	}
+	newStubAPIServer(t, responses)
+
+	// ips are given in reverse order, output must follow the input order
+	reversed := make([]string, len(ips))
+	for i, ip := range ips {
+		reversed[len(ips)-1-i] = ip
+	}
+	var buf bytes.Buffer
+	options := &Options{
+		Ip:          reversed,
+		Concurrency: 8,
+		Output:      &buf,
+	}
+	// callbacks are serialised, the race detector reports unsynchronised access otherwise
+	var inputs []string
+	options.OnResult = func(o []*asnmap.Response) {
+		for _, response := range o {
+			inputs = append(inputs, response.Input)
+		}
+	}
+
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.process(context.Background()))
+	require.Equal(t, reversed, inputs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 50)
+	require.Equal(t, cidrs[49], lines[0])
+	require.Equal(t, cidrs[0], lines[49])
+
+	// sorted output
+	buf.Reset()
+	options.Sort = sortByIP
+	require.Nil(t, r.process(context.Background()))
+	require.Nil(t, r.Close())
+	require.Equal(t, strings.Join(cidrs, "\n")+"\n", buf.String())
+}
+
+func TestWriteSortedResponses(t *testing.T) {
+	responses := []*asnmap.Response{
+		{Input: "a", FirstIp: "20.0.2.0", LastIp: "20.0.2.255", ASN: 2, Org: "beta"},
+		{Input: "b", FirstIp: "2606:4700::", LastIp: "2606:4700::ffff", ASN: 1, Org: "Alpha"},
+		{Input: "c", ASN: 64512, Annotation: "private use ASN (RFC 6996)"},
+		{Input: "d", FirstIp: "20.0.10.0", LastIp: "20.0.10.255", ASN: 1, Org: "alpha"},
+		{Input: "e", FirstIp: "20.0.2.0", LastIp: "20.0.2.127", ASN: 3, Org: "gamma"},
+	}
+	tt := []struct {
+		sort     string
+		expected string
+	}{
+		{sortByInput, "abcde"},
+		{sortByASN, "dbaec"},
+		{sortByIP, "eadbc"},
+		{sortByOrg, "cdbae"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.sort, func(t *testing.T) {
+			var order string
+			options := &Options{Sort: tc.sort}
+			options.OnResult = func(o []*asnmap.Response) {
+				order += o[0].Input
+			}
+			var sorted []sortedResponse
+			for _, response := range responses {
+				sorted = append(sorted, sortedResponse{response: response})
+			}
+			r := &Runner{options: options}
+			require.Nil(t, r.writeSortedResponses(sorted))
+			require.Equal(t, tc.expected, order)
+		})
+	}
+}
+
+func TestProcessInterrupted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var ips []string
+	for i := 1; i <= 20; i++ {
+		ips = append(ips, fmt.Sprintf("20.0.%d.1", i))
+	}
+	server := newStubAPIServer(t, nil)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// the first lookup interrupts the run
+		cancel()
+		ip := req.URL.Query().Get("ip")
+		_ = json.NewEncoder(w).Encode([]*asnmap.Response{{FirstIp: ip, LastIp: ip, ASN: 1, Org: "org"}})
+	})
+
+	var buf bytes.Buffer
+	options := &Options{
+		Ip:          ips,
+		Concurrency: 2,
+		Output:      &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.ErrorIs(t, r.process(ctx), ErrInterrupted)
+	require.Nil(t, r.Close())
+
+	// in-flight lookups are written, no new ones are started
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Equal(t, int64(len(lines)), r.stats.processed.Load())
+	require.Less(t, r.stats.processed.Load(), int64(20))
+	require.Equal(t, int64(20), r.stats.total.Load())
+	require.Equal(t, "20.0.1.1/32", lines[0])
+}
+
+func TestProcessFailedInputs(t *testing.T) {
+	server := newStubAPIServer(t, nil)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := req.URL.Query().Get("ip")
+		if ip == "20.0.2.1" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte("invalid\nquery"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]*asnmap.Response{{FirstIp: ip, LastIp: ip, ASN: 1, Org: "org"}})
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		var buf, failed bytes.Buffer
+		options := &Options{
+			Ip:              []string{"20.0.1.1", "20.0.2.1", "20.0.3.1"},
+			ContinueOnError: true,
+			Output:          &buf,
+		}
+		r, err := New(options)
+		require.Nil(t, err)
+		r.failedOutput = nopWriteCloser{&failed}
+		require.Nil(t, r.prepareInput())
+		err = r.process(context.Background())
+		require.ErrorIs(t, err, ErrFailedInputs)
+		require.Equal(t, "20.0.1.1/32\n20.0.3.1/32\n", buf.String())
+		require.Equal(t, "# bad request: invalid query\nip:20.0.2.1\n", failed.String())
+		require.Nil(t, r.Close())
+
+		// the failures report can be fed back in
+		options.Ip = nil
+		options.FileInput = strings.Split(strings.TrimSpace(failed.String()), "\n")
+		require.Nil(t, r.prepareInput())
+		require.Equal(t, 1, r.inputs)
+		require.Equal(t, "ip:20.0.2.1", r.inputKey(0))
+		require.Nil(t, r.Close())
+	})
+
+	t.Run("stop on error", func(t *testing.T) {
+		var buf bytes.Buffer
+		options := &Options{
+			Ip:     []string{"20.0.2.1", "20.0.1.1", "20.0.3.1"},
+			Output: &buf,
+		}
+		r, err := New(options)
+		require.Nil(t, err)
+		require.Nil(t, r.prepareInput())
+		err = r.process(context.Background())
+		require.NotNil(t, err)
+		require.NotErrorIs(t, err, ErrFailedInputs)
+		require.Empty(t, buf.String())
+		require.Nil(t, r.Close())
+	})
+
+	t.Run("invalid declared input", func(t *testing.T) {
+		var buf, failed bytes.Buffer
+		options := &Options{
+			Asn:    []string{"foo"},
+			Ip:     []string{"20.0.1.1", "not-an-ip"},
+			Output: &buf,
+		}
+		r, err := New(options)
+		require.Nil(t, err)
+		r.failedOutput = nopWriteCloser{&failed}
+		require.Nil(t, r.prepareInput())
+		// malformed inputs are reported without stopping the run
+		err = r.process(context.Background())
+		require.ErrorIs(t, err, ErrFailedInputs)
+		require.Equal(t, "20.0.1.1/32\n", buf.String())
+		require.Equal(t, "# invalid input: 'foo' is not an asn\nasn:foo\n# invalid input: 'not-an-ip' is not an ip, cidr or ip range\nip:not-an-ip\n", failed.String())
+		require.Nil(t, r.Close())
+	})
+
+	t.Run("unauthorized in continue mode", func(t *testing.T) {
+		server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})
+		var buf, failed bytes.Buffer
+		options := &Options{
+			Ip:              []string{"20.0.1.1", "20.0.2.1", "20.0.3.1"},
+			ContinueOnError: true,
+			Concurrency:     2,
+			Output:          &buf,
+		}
+		r, err := New(options)
+		require.Nil(t, err)
+		r.failedOutput = nopWriteCloser{&failed}
+		require.Nil(t, r.prepareInput())
+		err = r.process(context.Background())
+		require.ErrorIs(t, err, asnmap.ErrUnAuthorized)
+		require.NotErrorIs(t, err, ErrFailedInputs)
+		require.Empty(t, buf.String())
+		require.Empty(t, failed.String())
+		require.Zero(t, r.stats.failed.Load())
+		require.Nil(t, r.Close())
+	})
+}
+
+func TestRunAgainAfterUnauthorized(t *testing.T) {
+	server := newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=20.0.1.1": {{FirstIp: "20.0.1.0", LastIp: "20.0.1.255", ASN: 1, Org: "first", Country: "US"}},
+	})
+	var authorized atomic.Bool
+	handler := server.Config.Handler
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if !authorized.Load() {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+
+	dir := t.TempDir()
+	outputFile, failedFile := filepath.Join(dir, "output.csv"), filepath.Join(dir, "failed.txt")
+	options := &Options{
+		Ip:           []string{"20.0.1.1", "AS"},
+		DisplayInCSV: true,
+		OutputFile:   outputFile,
+		FailedOutput: failedFile,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.ErrorIs(t, r.Run(), asnmap.ErrUnAuthorized)
+	file, failed := r.outputFile, r.failedOutput
+
+	// the rerun reuses the output files and starts them over
+	authorized.Store(true)
+	require.ErrorIs(t, r.Run(), ErrFailedInputs)
+	require.Same(t, file, r.outputFile)
+	require.Equal(t, failed, r.failedOutput)
+	require.Nil(t, r.Close())
+
+	output, err := os.ReadFile(outputFile)
+	require.Nil(t, err)
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, strings.Join(r.csvHeader(), "|"), lines[0])
+	require.Contains(t, lines[1], "|20.0.1.1|AS1|first|US|20.0.1.0/24")
+	failedOutput, err := os.ReadFile(failedFile)
+	require.Nil(t, err)
+	require.Equal(t, 1, strings.Count(string(failedOutput), "ip:AS\n"))
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestRunStats(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=20.0.1.1":   {{FirstIp: "20.0.0.0", LastIp: "20.0.3.255", ASN: 1, Org: "first", Country: "US"}},
+		"ip=20.0.2.1":   {{FirstIp: "20.0.0.0", LastIp: "20.0.3.255", ASN: 1, Org: "First", Country: "US"}},
+		"asn=2":         {{FirstIp: "2a00::", LastIp: "2a00::ffff", ASN: 2, Org: "second", Country: "DE"}},
+		"ip=20.0.9.1":   {{FirstIp: "20.0.9.0", LastIp: "20.0.9.127", ASN: 3, Org: "third", Country: "DE"}},
+		"ip=20.0.10.10": {{FirstIp: "20.0.10.0", LastIp: "20.0.10.255", ASN: 3, Org: "third", Country: "DE"}},
+	})
+
+	statsFile := filepath.Join(t.TempDir(), "stats.json")
+	options := &Options{
+		Ip:        []string{"20.0.1.1", "20.0.2.1", "20.0.9.1", "20.0.10.10"},
+		Asn:       []string{"AS2"},
+		StatsJSON: statsFile,
+		Output:    io.Discard,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.prepareInput())
+	require.Nil(t, r.process(context.Background()))
+	require.Nil(t, r.writeSummary())
+	require.Nil(t, r.Close())
+
+	data, err := os.ReadFile(statsFile)
+	require.Nil(t, err)
+	var summary statsSummary
+	require.Nil(t, json.Unmarshal(data, &summary))
+	require.Equal(t, int64(5), summary.Total)
+	require.Equal(t, int64(5), summary.Processed)
+	require.Equal(t, int64(5), summary.Lookups)
+	require.Equal(t, map[string]int64{"ip": 4, "asn": 1}, summary.InputTypes)
+	require.Equal(t, 3, summary.ASNs)
+	require.Equal(t, 3, summary.Orgs)
+	require.Equal(t, 2, summary.Countries)
+	// the range shared by the first two ips is counted once
+	require.Equal(t, "1408", summary.IPv4Addresses.String())
+	require.Equal(t, "65536", summary.IPv6Addresses.String())
+	require.Contains(t, r.stats.progress(), "Inputs: 5/5 (100%)")
+}
+
+func TestProcessDedupeAndAggregate(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=20.0.0.1": {{FirstIp: "20.0.0.0", LastIp: "20.0.1.255", ASN: 1, Org: "first"}},
+		"ip=20.0.1.1": {{FirstIp: "20.0.0.0", LastIp: "20.0.1.255", ASN: 1, Org: "first"}},
+		"ip=20.0.2.1": {{FirstIp: "20.0.2.0", LastIp: "20.0.3.255", ASN: 2, Org: "second"}},
+	})
+
+	tt := []struct {
+		name     string
+		options  Options
+		expected string
+	}{
+		{"default", Options{}, "20.0.0.0/23\n20.0.0.0/23\n20.0.2.0/23\n"},
+		{"dedupe", Options{Dedupe: true}, "20.0.0.0/23\n20.0.2.0/23\n"},
+		{"aggregate", Options{Aggregate: true}, "20.0.0.0/22\n"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			options := tc.options
+			options.Ip = []string{"20.0.1.1", "20.0.0.1", "20.0.2.1"}
+			options.Output = &buf
+			r, err := New(&options)
+			require.Nil(t, err)
+			require.Nil(t, r.prepareInput())
+			require.Nil(t, r.process(context.Background()))
+			require.Equal(t, tc.expected, buf.String())
+			require.Nil(t, r.Close())
+		})
+	}
+
+	t.Run("dedupe json", func(t *testing.T) {
+		var buf bytes.Buffer
+		options := &Options{
+			Ip:            []string{"20.0.1.1", "20.0.0.1", "20.0.2.1"},
+			Dedupe:        true,
+			DisplayInJSON: true,
+			Output:        &buf,
+		}
+		r, err := New(options)
+		require.Nil(t, err)
+		require.Nil(t, r.prepareInput())
+		require.Nil(t, r.process(context.Background()))
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		require.Len(t, lines, 2)
+		require.Contains(t, lines[0], `"input":"20.0.1.1"`)
+		require.Contains(t, lines[1], `"input":"20.0.2.1"`)
+		require.Nil(t, r.Close())
+	})
+}
+
+func TestSetupProxyFromEnv(t *testing.T) {
+	t.Setenv("SERVER_URL", "http://asnmap.invalid")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	deadProxy := "http://" + listener.Addr().String()
+	require.Nil(t, listener.Close())
+	t.Setenv("HTTP_PROXY", deadProxy)
+	t.Setenv("NO_PROXY", "")
+
+	// an unreachable environment proxy falls back to direct connections
+	r, err := New(&Options{})
+	require.Nil(t, err)
+	require.Nil(t, r.setupProxy())
+	require.Nil(t, r.proxyPool)
+
+	// while an unreachable proxy option fails the run
+	r, err = New(&Options{Proxy: []string{deadProxy}})
+	require.Nil(t, err)
+	require.NotNil(t, r.setupProxy())
+}
+
+func TestWriteCSVOutput(t *testing.T) {
+	responses := []*asnmap.Response{{FirstIp: "20.0.0.0", LastIp: "20.0.0.255", Input: "20.0.0.1", InputType: "ip", ASN: 1, Org: "first", Country: "US"}}
+
+	for _, withInputType := range []bool{false, true} {
+		var buf bytes.Buffer
+		r := &Runner{options: &Options{DisplayInCSV: true, CSVInputType: withInputType, Output: &buf}}
+		require.Nil(t, r.writeOutput(responses))
+		record := strings.Split(strings.TrimSpace(buf.String()), "|")
+		header := r.csvHeader()
+		require.Len(t, record, len(header))
+		if withInputType {
+			require.Equal(t, "input_type", header[len(header)-1])
+			require.Equal(t, "ip", record[len(record)-1])
+		} else {
+			require.Equal(t, "as_range", header[len(header)-1])
+			require.Equal(t, "20.0.0.0/24", record[len(record)-1])
+		}
+	}
+}
+
+func TestWriteCSVOutputAnnotation(t *testing.T) {
+	var buf bytes.Buffer
+	r := &Runner{options: &Options{DisplayInCSV: true, Output: &buf}}
+	require.Nil(t, r.writeOutput([]*asnmap.Response{{Input: "10.0.0.1", InputType: "ip", Annotation: "private use (RFC 1918)"}}))
+	record := strings.Split(strings.TrimSpace(buf.String()), "|")
+	require.Equal(t, []string{"10.0.0.1", "", "private use (RFC 1918)", "", ""}, record[1:])
+}
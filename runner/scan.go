@@ -0,0 +1,280 @@
+package runner
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	iputil "github.com/projectdiscovery/utils/ip"
+)
+
+// scanHost is a host found in nmap or masscan output along with its open ports
+type scanHost struct {
+	IP    string
+	Ports []string
+}
+
+// nmapRun is the subset of the nmap -oX format needed to extract hosts
+type nmapRun struct {
+	Hosts []struct {
+		Status struct {
+			State string `xml:"state,attr"`
+		} `xml:"status"`
+		Addresses []struct {
+			Addr     string `xml:"addr,attr"`
+			AddrType string `xml:"addrtype,attr"`
+		} `xml:"address"`
+		Ports []struct {
+			Protocol string `xml:"protocol,attr"`
+			PortID   int    `xml:"portid,attr"`
+			State    struct {
+				State string `xml:"state,attr"`
+			} `xml:"state"`
+		} `xml:"ports>port"`
+	} `xml:"host"`
+}
+
+// parseNmapXML returns every host that is up or has an open port
+func parseNmapXML(data string) ([]scanHost, error) {
+	var run nmapRun
+	if err := xml.Unmarshal([]byte(data), &run); err != nil {
+		return nil, fmt.Errorf("could not parse nmap xml: %w", err)
+	}
+
+	var hosts []scanHost
+	for _, h := range run.Hosts {
+		var host scanHost
+		for _, address := range h.Addresses {
+			if address.AddrType == "ipv4" || address.AddrType == "ipv6" {
+				host.IP = address.Addr
+				break
+			}
+		}
+		for _, port := range h.Ports {
+			if port.State.State == "open" {
+				host.Ports = append(host.Ports, formatPort(port.PortID, port.Protocol))
+			}
+		}
+		if host.IP != "" && (h.Status.State == "up" || len(host.Ports) > 0) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// masscanRecord is a host of the masscan -oJ (and -oD) format
+type masscanRecord struct {
+	IP    string `json:"ip"`
+	Ports []struct {
+		Port   int    `json:"port"`
+		Proto  string `json:"proto"`
+		Status string `json:"status"`
+	} `json:"ports"`
+}
+
+// parseMasscan returns the open hosts of masscan json (-oJ, -oD) or list (-oL) output.
+// Json output is read per line, as older masscan versions write an invalid json array.
+func parseMasscan(lines []string) []scanHost {
+	var hosts []scanHost
+	index := map[string]int{}
+	add := func(ip, port string) {
+		i, ok := index[ip]
+		if !ok {
+			i = len(hosts)
+			index[ip] = i
+			hosts = append(hosts, scanHost{IP: ip})
+		}
+		if port != "" {
+			hosts[i].Ports = append(hosts[i].Ports, port)
+		}
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "{") {
+			var record masscanRecord
+			if err := json.Unmarshal([]byte(strings.TrimSuffix(line, ",")), &record); err != nil || record.IP == "" {
+				continue
+			}
+			for _, port := range record.Ports {
+				if port.Status == "" || port.Status == "open" {
+					add(record.IP, formatPort(port.Port, port.Proto))
+				}
+			}
+			continue
+		}
+		// list format: <status> <proto> <port> <ip> <timestamp>
+		fields := strings.Fields(line)
+		if len(fields) < 4 || fields[0] != "open" {
+			continue
+		}
+		port, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		add(fields[3], formatPort(port, fields[1]))
+	}
+	return hosts
+}
+
+func formatPort(port int, protocol string) string {
+	if protocol == "" {
+		protocol = "tcp"
+	}
+	return fmt.Sprintf("%d/%s", port, protocol)
+}
+
+// scanGroup is the summary of the scanned hosts owned by an asn
+type scanGroup struct {
+	ASN       string         `json:"as_number"`
+	ASName    string         `json:"as_name"`
+	ASCountry string         `json:"as_country"`
+	Hosts     int            `json:"hosts"`
+	IPs       []string       `json:"ips"`
+	Ports     map[string]int `json:"ports"`
+}
+
+// processScan reads nmap or masscan output from the input lines, looks up the owner
+// of every host and writes the hosts and open port counts per asn
+func (r *Runner) processScan(ctx context.Context, lines []string) error {
+	var hosts []scanHost
+	if r.options.InputFormat == inputFormatNmap {
+		var err error
+		if hosts, err = parseNmapXML(strings.Join(lines, "\n")); err != nil {
+			return err
+		}
+	} else {
+		hosts = parseMasscan(lines)
+	}
+
+	r.stats.reset()
+	var cache responseCache
+	groups := map[int]*scanGroup{}
+	for _, host := range hosts {
+		// an interrupted run reports the hosts looked up so far
+		if ctx.Err() != nil {
+			break
+		}
+		if !iputil.IsIP(host.IP) {
+			continue
+		}
+		response, err := r.lookupReportTarget(host.IP, &cache)
+		if err != nil {
+			return err
+		}
+		if response == nil {
+			continue
+		}
+		group, ok := groups[response.ASN]
+		if !ok {
+			group = &scanGroup{
+				ASN:       fmt.Sprintf("AS%d", response.ASN),
+				ASName:    response.Org,
+				ASCountry: response.Country,
+				Ports:     map[string]int{},
+			}
+			groups[response.ASN] = group
+		}
+		group.Hosts++
+		group.IPs = append(group.IPs, host.IP)
+		for _, port := range host.Ports {
+			group.Ports[port]++
+		}
+	}
+
+	sorted := make([]*scanGroup, 0, len(groups))
+	for _, group := range groups {
+		sorted = append(sorted, group)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Hosts != sorted[j].Hosts {
+			return sorted[i].Hosts > sorted[j].Hosts
+		}
+		return sorted[i].ASN < sorted[j].ASN
+	})
+	if err := r.writeScanGroups(sorted); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ErrInterrupted
+	}
+	return r.failedInputsError()
+}
+
+// sortedPorts returns the ports ordered by the number of hosts they are open on
+func (g *scanGroup) sortedPorts() []string {
+	ports := make([]string, 0, len(g.Ports))
+	for port := range g.Ports {
+		ports = append(ports, port)
+	}
+	sort.Slice(ports, func(i, j int) bool {
+		if g.Ports[ports[i]] != g.Ports[ports[j]] {
+			return g.Ports[ports[i]] > g.Ports[ports[j]]
+		}
+		return ports[i] < ports[j]
+	})
+	for i, port := range ports {
+		ports[i] = fmt.Sprintf("%s=%d", port, g.Ports[port])
+	}
+	return ports
+}
+
+func (r *Runner) writeScanGroups(groups []*scanGroup) error {
+	if r.options.Output == nil {
+		return nil
+	}
+	switch {
+	case r.options.DisplayInJSON:
+		for _, group := range groups {
+			record, err := json.Marshal(group)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(r.options.Output, "%s\n", record); err != nil {
+				return err
+			}
+		}
+	case r.options.DisplayInCSV:
+		w := csv.NewWriter(r.options.Output)
+		w.Comma = '|'
+		if err := w.Write([]string{"as_number", "as_name", "as_country", "hosts", "ports"}); err != nil {
+			return err
+		}
+		for _, group := range groups {
+			if err := w.Write([]string{group.ASN, group.ASName, group.ASCountry, strconv.Itoa(group.Hosts), strings.Join(group.sortedPorts(), ",")}); err != nil {
+				return err
+			}
+		}
+		w.Flush()
+		return w.Error()
+	default:
+		for _, group := range groups {
+			if _, err := fmt.Fprintf(r.options.Output, "%s [%s] [%s] hosts=%d ports=%s\n", group.ASN, group.ASName, group.ASCountry, group.Hosts, strings.Join(group.sortedPorts(), ",")); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readLines returns the lines of the reader followed by the file input lines
+func (r *Runner) readLines(input io.Reader) ([]string, error) {
+	var lines []string
+	if input != nil {
+		data, err := io.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		lines = strings.Split(string(data), "\n")
+	}
+	return append(lines, r.options.FileInput...), nil
+}
@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/stretchr/testify/require"
+)
+
+const nmapXML = `<?xml version="1.0"?>
+<nmaprun scanner="nmap">
+<host><status state="up"/><address addr="104.16.99.52" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="443"><state state="open"/></port><port protocol="tcp" portid="80"><state state="open"/></port><port protocol="tcp" portid="22"><state state="closed"/></port></ports></host>
+<host><status state="up"/><address addr="00:11:22:33:44:55" addrtype="mac"/><address addr="104.16.1.1" addrtype="ipv4"/>
+<ports><port protocol="tcp" portid="443"><state state="open"/></port></ports></host>
+<host><status state="down"/><address addr="8.8.8.8" addrtype="ipv4"/></host>
+</nmaprun>`
+
+func TestParseNmapXML(t *testing.T) {
+	hosts, err := parseNmapXML(nmapXML)
+	require.Nil(t, err)
+	require.Equal(t, []scanHost{
+		{IP: "104.16.99.52", Ports: []string{"443/tcp", "80/tcp"}},
+		{IP: "104.16.1.1", Ports: []string{"443/tcp"}},
+	}, hosts)
+
+	_, err = parseNmapXML("<nmaprun>")
+	require.NotNil(t, err)
+}
+
+func TestParseMasscan(t *testing.T) {
+	tt := []struct {
+		name  string
+		lines []string
+	}{
+		{"json", []string{
+			"[",
+			`{   "ip": "104.16.99.52",   "timestamp": "1690000000", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 54} ] },`,
+			`{   "ip": "104.16.99.52",   "timestamp": "1690000000", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 54} ] },`,
+			`{   "ip": "8.8.8.8",   "timestamp": "1690000000", "ports": [ {"port": 53, "proto": "udp", "status": "open", "reason": "none", "ttl": 54} ] }`,
+			"]",
+		}},
+		{"list", []string{
+			"#masscan",
+			"open tcp 443 104.16.99.52 1690000000",
+			"open tcp 80 104.16.99.52 1690000000",
+			"open udp 53 8.8.8.8 1690000000",
+			"# end",
+		}},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, []scanHost{
+				{IP: "104.16.99.52", Ports: []string{"443/tcp", "80/tcp"}},
+				{IP: "8.8.8.8", Ports: []string{"53/udp"}},
+			}, parseMasscan(tc.lines))
+		})
+	}
+}
+
+func TestProcessScan(t *testing.T) {
+	newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+
+	var buf bytes.Buffer
+	options := &Options{
+		InputFormat: inputFormatNmap,
+		Output:      &buf,
+	}
+	r, err := New(options)
+	require.Nil(t, err)
+	require.Nil(t, r.processScan(context.Background(), strings.Split(nmapXML, "\n")))
+	require.Nil(t, r.Close())
+
+	require.Equal(t, "AS13335 [cloudflarenet] [US] hosts=2 ports=443/tcp=2,80/tcp=1\n", buf.String())
+}
+
+func TestProcessScanLookupErrors(t *testing.T) {
+	server := newStubAPIServer(t, map[string][]*asnmap.Response{
+		"ip=104.16.99.52": {{FirstIp: "104.16.0.0", LastIp: "104.16.255.255", ASN: 13335, Country: "US", Org: "cloudflarenet"}},
+	})
+	handler := server.Config.Handler
+	var status atomic.Int32
+	status.Store(http.StatusInternalServerError)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("ip") == "8.8.8.8" {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+	lines := []string{"open tcp 443 104.16.99.52 1690000000", "open udp 53 8.8.8.8 1690000000"}
+
+	// hosts whose lookup failed fail the run instead of dropping out of the groups
+	var buf bytes.Buffer
+	r, err := New(&Options{InputFormat: inputFormatMasscan, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processScan(context.Background(), lines), ErrFailedInputs)
+	require.Equal(t, "AS13335 [cloudflarenet] [US] hosts=1 ports=443/tcp=1\n", buf.String())
+	require.Nil(t, r.Close())
+
+	status.Store(http.StatusUnauthorized)
+	r, err = New(&Options{InputFormat: inputFormatMasscan, Output: &buf})
+	require.Nil(t, err)
+	require.ErrorIs(t, r.processScan(context.Background(), lines), asnmap.ErrUnAuthorized)
+	require.Nil(t, r.Close())
+}
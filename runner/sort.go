@@ -0,0 +1,86 @@
+package runner
+
+import (
+	"net/netip"
+	"sort"
+	"strings"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+)
+
+// output sort modes
+const (
+	sortByInput = "input"
+	sortByASN   = "asn"
+	sortByIP    = "ip"
+	sortByOrg   = "org"
+)
+
+// sortedResponse is a response collected to be written once all lookups completed
+type sortedResponse struct {
+	response *asnmap.Response
+	records  []string
+}
+
+func appendSortedResponses(sorted []sortedResponse, job queuedItem) []sortedResponse {
+	for _, response := range job.result.responses {
+		sorted = append(sorted, sortedResponse{response: response, records: job.item.records})
+	}
+	return sorted
+}
+
+// writeSortedResponses sorts the responses by the -sort mode and writes them one by one.
+// Responses comparing equal keep their input order.
+func (r *Runner) writeSortedResponses(sorted []sortedResponse) error {
+	var less func(a, b *asnmap.Response) bool
+	switch r.options.Sort {
+	case sortByASN:
+		less = func(a, b *asnmap.Response) bool {
+			if a.ASN != b.ASN {
+				return a.ASN < b.ASN
+			}
+			return lessFirstIP(a, b)
+		}
+	case sortByIP:
+		less = lessFirstIP
+	case sortByOrg:
+		less = func(a, b *asnmap.Response) bool {
+			orgA, orgB := strings.ToLower(a.Org), strings.ToLower(b.Org)
+			if orgA != orgB {
+				return orgA < orgB
+			}
+			if a.ASN != b.ASN {
+				return a.ASN < b.ASN
+			}
+			return lessFirstIP(a, b)
+		}
+	}
+	if less != nil {
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return less(sorted[i].response, sorted[j].response)
+		})
+	}
+
+	for _, entry := range sorted {
+		if err := r.writeResults([]*asnmap.Response{entry.response}, entry.records); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lessFirstIP compares the responses by their first ip numerically, ipv4 before ipv6.
+// Responses without a range (annotated inputs) come last.
+func lessFirstIP(a, b *asnmap.Response) bool {
+	ipA, errA := netip.ParseAddr(a.FirstIp)
+	ipB, errB := netip.ParseAddr(b.FirstIp)
+	switch {
+	case errA != nil || errB != nil:
+		return errA == nil && errB != nil
+	case ipA != ipB:
+		return ipA.Less(ipB)
+	}
+	ipA, errA = netip.ParseAddr(a.LastIp)
+	ipB, errB = netip.ParseAddr(b.LastIp)
+	return errA == nil && errB == nil && ipA.Less(ipB)
+}
@@ -0,0 +1,196 @@
+package runner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	asnmap "github.com/projectdiscovery/asnmap/libs"
+	"github.com/projectdiscovery/gologger"
+)
+
+// runStats collects the progress and the findings of a run
+type runStats struct {
+	start     time.Time
+	total     atomic.Int64
+	processed atomic.Int64
+	failed    atomic.Int64
+	lookups   atomic.Int64
+
+	mu         sync.Mutex
+	inputTypes map[string]int64
+	asns       map[int]struct{}
+	orgs       map[string]struct{}
+	countries  map[string]struct{}
+	ranges     map[string]struct{}
+	ipv4       *big.Int
+	ipv6       *big.Int
+}
+
+// statsSummary is the json representation of the run statistics
+type statsSummary struct {
+	Total           int64            `json:"total"`
+	Processed       int64            `json:"processed"`
+	Failed          int64            `json:"failed"`
+	Lookups         int64            `json:"lookups"`
+	DurationSeconds float64          `json:"duration_seconds"`
+	InputTypes      map[string]int64 `json:"input_types"`
+	ASNs            int              `json:"asns"`
+	Orgs            int              `json:"orgs"`
+	Countries       int              `json:"countries"`
+	IPv4Addresses   *big.Int         `json:"ipv4_addresses"`
+	IPv6Addresses   *big.Int         `json:"ipv6_addresses"`
+}
+
+func newRunStats() *runStats {
+	s := &runStats{}
+	s.reset()
+	return s
+}
+
+// reset clears the statistics at the start of a run
+func (s *runStats) reset() {
+	s.total.Store(0)
+	s.processed.Store(0)
+	s.failed.Store(0)
+	s.lookups.Store(0)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.start = time.Now()
+	s.inputTypes = make(map[string]int64)
+	s.asns = make(map[int]struct{})
+	s.orgs = make(map[string]struct{})
+	s.countries = make(map[string]struct{})
+	s.ranges = make(map[string]struct{})
+	s.ipv4 = new(big.Int)
+	s.ipv6 = new(big.Int)
+}
+
+// observe records the responses of a successfully processed item
+func (s *runStats) observe(item inputItem, responses []*asnmap.Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.inputTypes[item.inputType.String()]++
+	for _, response := range responses {
+		if response.FirstIp == "" {
+			continue
+		}
+		s.asns[response.ASN] = struct{}{}
+		if response.Org != "" {
+			s.orgs[strings.ToLower(response.Org)] = struct{}{}
+		}
+		if response.Country != "" {
+			s.countries[response.Country] = struct{}{}
+		}
+
+		key := response.FirstIp + "-" + response.LastIp
+		if _, ok := s.ranges[key]; ok {
+			continue
+		}
+		s.ranges[key] = struct{}{}
+		first, errFirst := netip.ParseAddr(response.FirstIp)
+		last, errLast := netip.ParseAddr(response.LastIp)
+		if errFirst != nil || errLast != nil || last.Less(first) {
+			continue
+		}
+		size := new(big.Int).Sub(new(big.Int).SetBytes(last.AsSlice()), new(big.Int).SetBytes(first.AsSlice()))
+		size.Add(size, big.NewInt(1))
+		if first.Unmap().Is4() {
+			s.ipv4.Add(s.ipv4, size)
+		} else {
+			s.ipv6.Add(s.ipv6, size)
+		}
+	}
+}
+
+func (s *runStats) summary() statsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inputTypes := make(map[string]int64, len(s.inputTypes))
+	for inputType, count := range s.inputTypes {
+		inputTypes[inputType] = count
+	}
+	return statsSummary{
+		Total:           s.total.Load(),
+		Processed:       s.processed.Load(),
+		Failed:          s.failed.Load(),
+		Lookups:         s.lookups.Load(),
+		DurationSeconds: time.Since(s.start).Seconds(),
+		InputTypes:      inputTypes,
+		ASNs:            len(s.asns),
+		Orgs:            len(s.orgs),
+		Countries:       len(s.countries),
+		IPv4Addresses:   new(big.Int).Set(s.ipv4),
+		IPv6Addresses:   new(big.Int).Set(s.ipv6),
+	}
+}
+
+// progress returns the live progress line
+func (s *runStats) progress() string {
+	s.mu.Lock()
+	elapsed := time.Since(s.start)
+	s.mu.Unlock()
+
+	total, processed := s.total.Load(), s.processed.Load()
+	percent := int64(100)
+	if total > 0 {
+		percent = processed * 100 / total
+	}
+	rate := float64(s.lookups.Load()) / elapsed.Seconds()
+	eta := "-"
+	if processed > 0 && total >= processed {
+		remaining := time.Duration(float64(elapsed) / float64(processed) * float64(total-processed))
+		eta = remaining.Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] | Inputs: %d/%d (%d%%) | Lookups/s: %.1f | Errors: %d | ETA: %s",
+		elapsed.Round(time.Second), processed, total, percent, rate, s.failed.Load(), eta)
+}
+
+// showProgress prints the progress line to w every interval until stop is closed
+func (s *runStats) showProgress(w io.Writer, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			fmt.Fprintf(w, "\r%s", s.progress())
+		case <-stop:
+			fmt.Fprintf(w, "\r%s\n", s.progress())
+			return
+		}
+	}
+}
+
+// writeSummary logs the end of run statistics and writes them to the stats json file
+func (r *Runner) writeSummary() error {
+	summary := r.stats.summary()
+	if r.options.Stats {
+		inputTypes := make([]string, 0, len(summary.InputTypes))
+		for inputType, count := range summary.InputTypes {
+			inputTypes = append(inputTypes, fmt.Sprintf("%s=%d", inputType, count))
+		}
+		sort.Strings(inputTypes)
+		gologger.Info().Msgf("Processed %d/%d inputs in %s (%d failed, %d lookups)", summary.Processed, summary.Total,
+			time.Duration(summary.DurationSeconds*float64(time.Second)).Round(time.Millisecond), summary.Failed, summary.Lookups)
+		gologger.Info().Msgf("Inputs by type: %s", strings.Join(inputTypes, ", "))
+		gologger.Info().Msgf("Found %d ASNs, %d orgs, %d countries, %s IPv4 and %s IPv6 addresses", summary.ASNs, summary.Orgs, summary.Countries, summary.IPv4Addresses, summary.IPv6Addresses)
+	}
+
+	if r.options.StatsJSON == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(r.options.StatsJSON, append(data, '\n'), 0644)
+}